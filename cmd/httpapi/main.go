@@ -5,10 +5,17 @@ import (
 	"log"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/PerumallaGiridhar/oolio/internal/config"
+	"github.com/PerumallaGiridhar/oolio/internal/data"
 	"github.com/PerumallaGiridhar/oolio/internal/index"
+	"github.com/PerumallaGiridhar/oolio/internal/promo"
+	"github.com/PerumallaGiridhar/oolio/internal/ratelimit"
 	"github.com/PerumallaGiridhar/oolio/internal/routes"
+	"github.com/PerumallaGiridhar/oolio/internal/routes/coupon"
+	"github.com/PerumallaGiridhar/oolio/internal/routes/order"
+	"github.com/PerumallaGiridhar/oolio/internal/routes/product"
 	"github.com/PerumallaGiridhar/oolio/internal/validation"
 )
 
@@ -18,23 +25,142 @@ func main() {
 
 	cfg := config.Load()
 
-	log.Printf("Initializing pebble store")
-	index, err := index.NewPebbleIndex(cfg.PromoFiles)
+	backend, err := index.ParseBackend(cfg.PromoBackend)
 	if err != nil {
-		log.Fatalf("initializing pebble index: %v", err)
+		log.Fatalf("invalid promo config: %v", err)
 	}
-	defer index.Close()
+	lookupMode, err := index.ParseLookupMode(cfg.PromoLookupMode)
+	if err != nil {
+		log.Fatalf("invalid promo config: %v", err)
+	}
+	buildMethod, err := index.ParseBuildMethod(cfg.PromoBuildMethod)
+	if err != nil {
+		log.Fatalf("invalid promo config: %v", err)
+	}
+	policy, err := index.ParsePolicy(cfg.PromoCase, cfg.PromoStrip, cfg.PromoAlphabet, cfg.PromoMinLength, cfg.PromoMaxLength)
+	if err != nil {
+		log.Fatalf("invalid promo config: %v", err)
+	}
+	failMode, err := index.ParseFailMode(cfg.PromoFailMode)
+	if err != nil {
+		log.Fatalf("invalid promo config: %v", err)
+	}
+	if err := index.CheckQuorum(cfg.PromoFiles, cfg.PromoQuorum); err != nil {
+		log.Fatalf("invalid promo config: %v", err)
+	}
+	productStore, err := data.ParseProductStore(cfg.ProductStore)
+	if err != nil {
+		log.Fatalf("invalid product config: %v", err)
+	}
+	catalog := data.DefaultProducts()
+	if cfg.ProductsFile != "" {
+		if catalog, err = data.LoadCatalog(cfg.ProductsFile); err != nil {
+			log.Fatalf("loading products: %v", err)
+		}
+		log.Printf("read %d products from %s", len(catalog), cfg.ProductsFile)
+	}
+
+	// The index loads in the background so the server answers /live and
+	// product requests during a long first build. Orders wait for it.
+	log.Printf("Loading %s promo index in the background", backend)
+	promoIndex := index.Load(backend, cfg.PromoFiles, index.Options{
+		Quorum:      cfg.PromoQuorum,
+		Mode:        lookupMode,
+		Build:       index.BuildOptions{Method: buildMethod},
+		BloomBudget: int64(cfg.PromoBloomBudget) << 20,
+		Policy:      policy,
+		FailMode:    failMode,
+	})
+	defer promoIndex.Close()
+	go func() {
+		loaded, err := promoIndex.Wait(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Fatalf("initializing promo index: %v", err)
+			}
+			return
+		}
+		if pebbleIndex, ok := loaded.(*index.PebbleIndex); ok {
+			go pebbleIndex.Watch(ctx, time.Duration(cfg.PromoReload)*time.Second)
+			go pebbleIndex.WatchHealth(ctx, time.Duration(cfg.PromoHealth)*time.Second)
+		}
+	}()
 
-	if err := validation.HTTPRequestValidatorInit(index); err != nil {
+	if err := validation.HTTPRequestValidatorInit(policy); err != nil {
 		log.Fatalf("initializing HTTP request validator: %v", err)
 	}
 
-	server := CreateServer(cfg.Server, routes.NewRouter())
+	log.Printf("Opening order store at %s", cfg.DBDir)
+	db, err := index.OpenPebble(cfg.DBDir)
+	if err != nil {
+		log.Fatalf("opening order store: %v", err)
+	}
+	defer db.Close()
+
+	var products data.ProductRepository = data.NewMemoryProductRepository(catalog)
+	if productStore == data.ProductStorePebble {
+		pebbleProducts, err := data.NewPebbleProductRepository(db, catalog)
+		if err != nil {
+			log.Fatalf("opening product store: %v", err)
+		}
+		// A catalog file is the menu on every start, replacing admin edits.
+		if cfg.ProductsFile != "" {
+			if err := pebbleProducts.Replace(catalog); err != nil {
+				log.Fatalf("replacing stored products: %v", err)
+			}
+			log.Printf("replaced the stored menu with %d products from %s", len(catalog), cfg.ProductsFile)
+		}
+		products = pebbleProducts
+	}
+
+	rules, err := promo.NewEngine(cfg.PromoRulesFile, policy)
+	if err != nil {
+		log.Fatalf("loading promo rules: %v", err)
+	}
+	go rules.Watch(ctx, time.Duration(cfg.PromoRulesReload)*time.Second)
+
+	var failures *ratelimit.FailureTracker
+	if cfg.PromoFailureLimit > 0 {
+		failures = ratelimit.NewFailureTracker(cfg.PromoFailureLimit,
+			time.Duration(cfg.PromoLockoutBase)*time.Second, time.Duration(cfg.PromoLockoutMax)*time.Second)
+		failures.IPHeader = cfg.TrustedIPHeader
+	}
+
+	orders := &order.Handler{
+		Orders:      order.NewPebbleRepository(db),
+		Products:    products,
+		Coupons:     promoIndex,
+		Rules:       rules,
+		Ledger:      promo.NewLedger(db, policy),
+		Failures:    failures,
+		Policy:      policy,
+		PromosReady: promoIndex.Ready,
+		TaxRateBPS:  cfg.TaxRateBPS,
+	}
+	coupons := &coupon.Handler{Coupons: promoIndex, Products: products, Rules: rules, Failures: failures, Policy: policy}
+	if cfg.PromoValidateRate > 0 {
+		coupons.Limiter = ratelimit.New(cfg.PromoValidateRate, cfg.PromoValidateBurst)
+		coupons.Limiter.IPHeader = cfg.TrustedIPHeader
+	}
+	server := CreateServer(cfg.Server, routes.NewRouter(&product.Handler{Products: products, AdminKey: cfg.AdminAPIKey}, orders, coupons, promoIndex))
+
+	// The expvar counters are only served on a separate, internal listener.
+	var debugServer *Server
+	if cfg.DebugAddr != "" {
+		debugConfig := cfg.Server
+		debugConfig.Addr = cfg.DebugAddr
+		debugServer = CreateServer(debugConfig, routes.NewDebugRouter())
+		log.Printf("serving /debug/vars on %s", cfg.DebugAddr)
+		go debugServer.Start()
+	}
 
 	log.Printf("🚀 starting server on %s", cfg.Server.Addr)
 	go server.Start()
 	<-ctx.Done()
 	log.Println("🛑 shutdown signal received")
 	server.GraceFullShutdown(ctx)
+	if debugServer != nil {
+		debugServer.GraceFullShutdown(ctx)
+	}
 	log.Println("✅ graceful shutdown complete")
 }
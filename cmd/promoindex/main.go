@@ -0,0 +1,235 @@
+// Command promoindex builds, verifies, inspects and queries the Pebble promo
+// indexes offline, so they can be prepared on the data volume before the
+// HTTP server starts.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/PerumallaGiridhar/oolio/internal/config"
+	"github.com/PerumallaGiridhar/oolio/internal/index"
+)
+
+const usage = `usage: promoindex <command> [flags] [files...]
+
+Commands:
+  build    build missing or stale indexes (-force rebuilds all, -method ingest|batch)
+  verify   check indexes are complete and match their sources
+  inspect  print key count, disk size and metadata (-json for JSON)
+  query    look codes up across the indexes (-quorum k)
+
+Files default to PROMO_FILES when none are given.
+`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg := config.Load()
+	var err error
+	switch os.Args[1] {
+	case "build":
+		err = runBuild(cfg, os.Args[2:])
+	case "verify":
+		err = runVerify(cfg, os.Args[2:])
+	case "inspect":
+		err = runInspect(cfg, os.Args[2:])
+	case "query":
+		err = runQuery(cfg, os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("promoindex %s: %v", os.Args[1], err)
+	}
+}
+
+func filesOrDefault(cfg config.Config, args []string) []string {
+	if len(args) > 0 {
+		return args
+	}
+	return cfg.PromoFiles
+}
+
+// promoPolicy is the code policy the HTTP server uses, so indexes built
+// here are not rebuilt at startup.
+func promoPolicy(cfg config.Config) (index.Policy, error) {
+	return index.ParsePolicy(cfg.PromoCase, cfg.PromoStrip, cfg.PromoAlphabet, cfg.PromoMinLength, cfg.PromoMaxLength)
+}
+
+func runBuild(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	force := fs.Bool("force", false, "rebuild even if the index is up to date")
+	method := fs.String("method", cfg.PromoBuildMethod, "how codes are loaded: ingest or batch")
+	_ = fs.Parse(args)
+
+	buildMethod, err := index.ParseBuildMethod(*method)
+	if err != nil {
+		return err
+	}
+	policy, err := promoPolicy(cfg)
+	if err != nil {
+		return err
+	}
+	opts := index.BuildOptions{Method: buildMethod, Policy: policy}
+
+	for _, path := range filesOrDefault(cfg, fs.Args()) {
+		build := index.EnsurePebble
+		if *force {
+			build = index.RebuildPebble
+		}
+		store, err := build(path, opts)
+		if err != nil {
+			return err
+		}
+		log.Printf("%s: %d codes, built %s", store.DbDir, store.Meta.Codes, store.Meta.BuiltAt.Format("2006-01-02T15:04:05Z07:00"))
+		if err := store.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runVerify(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	_ = fs.Parse(args)
+
+	policy, err := promoPolicy(cfg)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, path := range filesOrDefault(cfg, fs.Args()) {
+		if err := index.VerifyPebble(path, policy); err != nil {
+			log.Printf("FAIL %s: %v", path, err)
+			failed++
+			continue
+		}
+		log.Printf("OK   %s", path)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d index(es) failed verification", failed)
+	}
+	return nil
+}
+
+func runInspect(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	_ = fs.Parse(args)
+
+	policy, err := promoPolicy(cfg)
+	if err != nil {
+		return err
+	}
+	var all []index.StoreStats
+	for _, path := range filesOrDefault(cfg, fs.Args()) {
+		store, err := index.OpenPebbleStore(path, policy)
+		if err != nil {
+			return err
+		}
+		stats, err := store.Stats()
+		store.Close()
+		if err != nil {
+			return err
+		}
+		all = append(all, stats)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(all)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "INDEX\tKEYS\tSIZE\tLINES\tSHA256\tBUILT")
+	for _, s := range all {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f MiB\t%d\t%.12s\t%s\n",
+			s.DbDir, s.Keys, float64(s.DiskBytes)/(1<<20), s.Meta.Lines, s.Meta.SHA256,
+			s.Meta.BuiltAt.Format("2006-01-02T15:04:05Z07:00"))
+	}
+	return tw.Flush()
+}
+
+func runQuery(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	quorum := fs.Int("quorum", cfg.PromoQuorum, "stores that must contain a code")
+	files := fs.String("files", "", "comma-separated promo files (default PROMO_FILES)")
+	_ = fs.Parse(args)
+
+	codes := fs.Args()
+	if len(codes) == 0 {
+		return fmt.Errorf("no codes given")
+	}
+	paths := cfg.PromoFiles
+	if *files != "" {
+		paths = config.SplitCSV(*files)
+	}
+
+	policy, err := promoPolicy(cfg)
+	if err != nil {
+		return err
+	}
+	pi := &index.PebbleIndex{Quorum: *quorum, Policy: policy}
+	defer pi.Close()
+	for _, path := range paths {
+		store, err := index.OpenPebbleStore(path, policy)
+		if err != nil {
+			return err
+		}
+		pi.Stores = append(pi.Stores, store)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprint(tw, "CODE")
+	for i := range pi.Stores {
+		fmt.Fprintf(tw, "\tSTORE%d", i+1)
+	}
+	fmt.Fprintf(tw, "\tSTATUS(%d of %d)\n", pi.Quorum, len(pi.Stores))
+
+	for _, code := range codes {
+		fmt.Fprint(tw, code)
+		for _, s := range pi.Stores {
+			w, ok, err := s.Lookup(code)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(tw, "\t%s", describeWindow(w, ok))
+		}
+		status, err := pi.Lookup(context.Background(), code, time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "\t%s\n", status)
+	}
+	return tw.Flush()
+}
+
+// describeWindow renders one store's answer for the query table: false when
+// the store lacks the code, otherwise true followed by its window, if any.
+func describeWindow(w index.Window, ok bool) string {
+	if !ok || w.IsZero() {
+		return fmt.Sprint(ok)
+	}
+	format := func(t time.Time) string {
+		if t.IsZero() {
+			return "…"
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("true [%s, %s)", format(w.StartsAt), format(w.EndsAt))
+}
@@ -21,7 +21,7 @@ func BindAndValidateJSONRequest(r *http.Request, dst any) map[string]string {
 		return map[string]string{"error": "invalid or unknown JSON fields"}
 	}
 
-	if err := validation.Validator.Struct(dst); err != nil {
+	if err := validation.Validator.StructCtx(r.Context(), dst); err != nil {
 		if ve, ok := err.(validator.ValidationErrors); ok {
 			fields := make(map[string]string, len(ve))
 			log.Println("ve: ", ve)
@@ -15,8 +15,35 @@ type ServerConfig struct {
 }
 
 type Config struct {
-	Server     ServerConfig
-	PromoFiles []string
+	Server             ServerConfig
+	PromoFiles         []string
+	PromoBackend       string
+	PromoQuorum        int
+	PromoLookupMode    string
+	PromoReload        int
+	PromoBuildMethod   string
+	PromoBloomBudget   int
+	PromoRulesFile     string
+	PromoRulesReload   int
+	PromoValidateRate  int
+	PromoValidateBurst int
+	PromoFailureLimit  int
+	PromoLockoutBase   int
+	PromoLockoutMax    int
+	PromoCase          string
+	PromoStrip         string
+	PromoAlphabet      string
+	PromoMinLength     int
+	PromoMaxLength     int
+	PromoFailMode      string
+	PromoHealth        int
+	DBDir              string
+	ProductStore       string
+	ProductsFile       string
+	AdminAPIKey        string
+	DebugAddr          string
+	TrustedIPHeader    string
+	TaxRateBPS         int
 }
 
 func getEnvWithDefault(key, def string) string {
@@ -36,7 +63,9 @@ func getEnvIntWithDefault(key string, def int) int {
 	return def
 }
 
-func splitCSV(s string) []string {
+// SplitCSV splits a comma-separated list, trimming entries and dropping
+// empty ones.
+func SplitCSV(s string) []string {
 	parts := strings.Split(s, ",")
 	out := make([]string, 0, len(parts))
 	for _, p := range parts {
@@ -57,6 +86,33 @@ func Load() Config {
 			IdleTimeout:       getEnvIntWithDefault("IDLE_TIMEOUT", 60),
 			ReadHeaderTimeout: getEnvIntWithDefault("READ_HEADER_TIMEOUT", 3),
 		},
-		PromoFiles: splitCSV(getEnvWithDefault("PROMO_FILES", "/Users/giridhar/Downloads/safe_extract/couponbase1,/Users/giridhar/Downloads/safe_extract/couponbase2,/Users/giridhar/Downloads/safe_extract/couponbase3")),
+		DBDir:              getEnvWithDefault("DB_DIR", "data/oolio.peb"),
+		ProductStore:       getEnvWithDefault("PRODUCT_STORE", "pebble"),
+		ProductsFile:       getEnvWithDefault("PRODUCTS_FILE", ""),
+		AdminAPIKey:        getEnvWithDefault("ADMIN_API_KEY", ""),
+		DebugAddr:          getEnvWithDefault("DEBUG_ADDR", ""),
+		TrustedIPHeader:    getEnvWithDefault("TRUSTED_IP_HEADER", ""),
+		TaxRateBPS:         getEnvIntWithDefault("TAX_RATE_BPS", 0),
+		PromoFiles:         SplitCSV(getEnvWithDefault("PROMO_FILES", "/Users/giridhar/Downloads/safe_extract/couponbase1,/Users/giridhar/Downloads/safe_extract/couponbase2,/Users/giridhar/Downloads/safe_extract/couponbase3")),
+		PromoBackend:       getEnvWithDefault("PROMO_BACKEND", "pebble"),
+		PromoQuorum:        getEnvIntWithDefault("PROMO_QUORUM", 2),
+		PromoLookupMode:    getEnvWithDefault("PROMO_LOOKUP_MODE", "sequential"),
+		PromoReload:        getEnvIntWithDefault("PROMO_RELOAD", 60),
+		PromoBuildMethod:   getEnvWithDefault("PROMO_BUILD_METHOD", "ingest"),
+		PromoBloomBudget:   getEnvIntWithDefault("PROMO_BLOOM_BUDGET_MB", 0),
+		PromoRulesFile:     getEnvWithDefault("PROMO_RULES_FILE", ""),
+		PromoRulesReload:   getEnvIntWithDefault("PROMO_RULES_RELOAD", 30),
+		PromoValidateRate:  getEnvIntWithDefault("PROMO_VALIDATE_RATE", 30),
+		PromoValidateBurst: getEnvIntWithDefault("PROMO_VALIDATE_BURST", 10),
+		PromoFailureLimit:  getEnvIntWithDefault("PROMO_FAILURE_LIMIT", 5),
+		PromoLockoutBase:   getEnvIntWithDefault("PROMO_LOCKOUT_BASE", 30),
+		PromoLockoutMax:    getEnvIntWithDefault("PROMO_LOCKOUT_MAX", 3600),
+		PromoCase:          getEnvWithDefault("PROMO_CASE", "upper"),
+		PromoStrip:         getEnvWithDefault("PROMO_STRIP", ""),
+		PromoAlphabet:      getEnvWithDefault("PROMO_ALPHABET", ""),
+		PromoMinLength:     getEnvIntWithDefault("PROMO_MIN_LENGTH", 8),
+		PromoMaxLength:     getEnvIntWithDefault("PROMO_MAX_LENGTH", 10),
+		PromoFailMode:      getEnvWithDefault("PROMO_FAIL_MODE", "closed"),
+		PromoHealth:        getEnvIntWithDefault("PROMO_HEALTH_INTERVAL", 15),
 	}
 }
@@ -46,13 +46,13 @@ func TestSplitCSV(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		got := splitCSV(tt.in)
+		got := SplitCSV(tt.in)
 		if len(got) != len(tt.want) {
-			t.Fatalf("splitCSV(%q) len=%d, want %d", tt.in, len(got), len(tt.want))
+			t.Fatalf("SplitCSV(%q) len=%d, want %d", tt.in, len(got), len(tt.want))
 		}
 		for i := range got {
 			if got[i] != tt.want[i] {
-				t.Fatalf("splitCSV(%q)[%d]=%q, want %q", tt.in, i, got[i], tt.want[i])
+				t.Fatalf("SplitCSV(%q)[%d]=%q, want %q", tt.in, i, got[i], tt.want[i])
 			}
 		}
 	}
@@ -68,6 +68,33 @@ func TestLoad_UsesEnvAndDefaults(t *testing.T) {
 
 	// promo files
 	t.Setenv("PROMO_FILES", "/tmp/a,/tmp/b")
+	t.Setenv("PROMO_BACKEND", "memory")
+	t.Setenv("PROMO_QUORUM", "1")
+	t.Setenv("PROMO_LOOKUP_MODE", "parallel")
+	t.Setenv("PROMO_RELOAD", "0")
+	t.Setenv("PROMO_BUILD_METHOD", "batch")
+	t.Setenv("PROMO_BLOOM_BUDGET_MB", "64")
+	t.Setenv("DB_DIR", "/tmp/oolio.peb")
+	t.Setenv("PRODUCT_STORE", "memory")
+	t.Setenv("PRODUCTS_FILE", "/tmp/products.csv")
+	t.Setenv("ADMIN_API_KEY", "s3cret")
+	t.Setenv("DEBUG_ADDR", "127.0.0.1:9090")
+	t.Setenv("TRUSTED_IP_HEADER", "Fly-Client-IP")
+	t.Setenv("TAX_RATE_BPS", "825")
+	t.Setenv("PROMO_RULES_FILE", "/tmp/rules.json")
+	t.Setenv("PROMO_RULES_RELOAD", "5")
+	t.Setenv("PROMO_VALIDATE_RATE", "12")
+	t.Setenv("PROMO_VALIDATE_BURST", "3")
+	t.Setenv("PROMO_FAILURE_LIMIT", "8")
+	t.Setenv("PROMO_LOCKOUT_BASE", "10")
+	t.Setenv("PROMO_LOCKOUT_MAX", "600")
+	t.Setenv("PROMO_CASE", "lower")
+	t.Setenv("PROMO_STRIP", "- ")
+	t.Setenv("PROMO_ALPHABET", "a-z0-9")
+	t.Setenv("PROMO_MIN_LENGTH", "6")
+	t.Setenv("PROMO_MAX_LENGTH", "12")
+	t.Setenv("PROMO_FAIL_MODE", "open")
+	t.Setenv("PROMO_HEALTH_INTERVAL", "5")
 
 	cfg := Load()
 
@@ -90,4 +117,63 @@ func TestLoad_UsesEnvAndDefaults(t *testing.T) {
 	if len(cfg.PromoFiles) != 2 || cfg.PromoFiles[0] != "/tmp/a" || cfg.PromoFiles[1] != "/tmp/b" {
 		t.Errorf("PromoFiles = %#v, want []string{\"/tmp/a\",\"/tmp/b\"}", cfg.PromoFiles)
 	}
+	if cfg.PromoBackend != "memory" {
+		t.Errorf("PromoBackend = %q, want %q", cfg.PromoBackend, "memory")
+	}
+	if cfg.PromoQuorum != 1 {
+		t.Errorf("PromoQuorum = %d, want %d", cfg.PromoQuorum, 1)
+	}
+	if cfg.PromoLookupMode != "parallel" {
+		t.Errorf("PromoLookupMode = %q, want %q", cfg.PromoLookupMode, "parallel")
+	}
+	if cfg.PromoReload != 0 {
+		t.Errorf("PromoReload = %d, want %d", cfg.PromoReload, 0)
+	}
+	if cfg.PromoBuildMethod != "batch" {
+		t.Errorf("PromoBuildMethod = %q, want %q", cfg.PromoBuildMethod, "batch")
+	}
+	if cfg.PromoBloomBudget != 64 {
+		t.Errorf("PromoBloomBudget = %d, want %d", cfg.PromoBloomBudget, 64)
+	}
+	if cfg.DBDir != "/tmp/oolio.peb" {
+		t.Errorf("DBDir = %q, want %q", cfg.DBDir, "/tmp/oolio.peb")
+	}
+	if cfg.ProductStore != "memory" {
+		t.Errorf("ProductStore = %q, want %q", cfg.ProductStore, "memory")
+	}
+	if cfg.ProductsFile != "/tmp/products.csv" {
+		t.Errorf("ProductsFile = %q, want %q", cfg.ProductsFile, "/tmp/products.csv")
+	}
+	if cfg.AdminAPIKey != "s3cret" {
+		t.Errorf("AdminAPIKey = %q, want %q", cfg.AdminAPIKey, "s3cret")
+	}
+	if cfg.DebugAddr != "127.0.0.1:9090" {
+		t.Errorf("DebugAddr = %q, want %q", cfg.DebugAddr, "127.0.0.1:9090")
+	}
+	if cfg.TrustedIPHeader != "Fly-Client-IP" {
+		t.Errorf("TrustedIPHeader = %q, want %q", cfg.TrustedIPHeader, "Fly-Client-IP")
+	}
+	if cfg.TaxRateBPS != 825 {
+		t.Errorf("TaxRateBPS = %d, want %d", cfg.TaxRateBPS, 825)
+	}
+	if cfg.PromoRulesFile != "/tmp/rules.json" || cfg.PromoRulesReload != 5 {
+		t.Errorf("PromoRulesFile/PromoRulesReload = %q/%d, want %q/%d", cfg.PromoRulesFile, cfg.PromoRulesReload, "/tmp/rules.json", 5)
+	}
+	if cfg.PromoValidateRate != 12 || cfg.PromoValidateBurst != 3 {
+		t.Errorf("PromoValidateRate/PromoValidateBurst = %d/%d, want %d/%d", cfg.PromoValidateRate, cfg.PromoValidateBurst, 12, 3)
+	}
+	if cfg.PromoFailureLimit != 8 || cfg.PromoLockoutBase != 10 || cfg.PromoLockoutMax != 600 {
+		t.Errorf("PromoFailureLimit/PromoLockoutBase/PromoLockoutMax = %d/%d/%d, want %d/%d/%d",
+			cfg.PromoFailureLimit, cfg.PromoLockoutBase, cfg.PromoLockoutMax, 8, 10, 600)
+	}
+	if cfg.PromoCase != "lower" || cfg.PromoStrip != "- " || cfg.PromoAlphabet != "a-z0-9" {
+		t.Errorf("PromoCase/PromoStrip/PromoAlphabet = %q/%q/%q, want %q/%q/%q",
+			cfg.PromoCase, cfg.PromoStrip, cfg.PromoAlphabet, "lower", "- ", "a-z0-9")
+	}
+	if cfg.PromoMinLength != 6 || cfg.PromoMaxLength != 12 {
+		t.Errorf("PromoMinLength/PromoMaxLength = %d/%d, want %d/%d", cfg.PromoMinLength, cfg.PromoMaxLength, 6, 12)
+	}
+	if cfg.PromoFailMode != "open" || cfg.PromoHealth != 5 {
+		t.Errorf("PromoFailMode/PromoHealth = %q/%d, want %q/%d", cfg.PromoFailMode, cfg.PromoHealth, "open", 5)
+	}
 }
@@ -0,0 +1,219 @@
+package data
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// CatalogFormat is a file format the product catalog can be read from and
+// written to.
+type CatalogFormat string
+
+const (
+	// CatalogJSON is a JSON array of products, as served by the API.
+	CatalogJSON CatalogFormat = "json"
+	// CatalogCSV has a header row naming catalogColumns and one product per
+	// row, with prices as decimals such as 6.50.
+	CatalogCSV CatalogFormat = "csv"
+)
+
+func ParseCatalogFormat(s string) (CatalogFormat, error) {
+	switch format := CatalogFormat(strings.ToLower(strings.TrimSpace(s))); format {
+	case CatalogJSON, CatalogCSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown catalog format %q", s)
+	}
+}
+
+// catalogColumns are the CSV columns in the order they are written. When
+// reading, columns may come in any order and the image columns may be left
+// out.
+var catalogColumns = []string{"id", "name", "category", "price", "thumbnail", "mobile", "tablet", "desktop"}
+
+// requiredCatalogColumns must be present in a CSV header.
+var requiredCatalogColumns = []string{"id", "name", "category", "price"}
+
+// productValidator checks catalog files against the same tags the API uses.
+var productValidator = validator.New()
+
+// validateProduct reports the first field of p that breaks its rules.
+func validateProduct(p Product) error {
+	err := productValidator.Struct(p)
+	var ve validator.ValidationErrors
+	if !errors.As(err, &ve) {
+		return err
+	}
+	fe := ve[0]
+	rule := fe.Tag()
+	if fe.Param() != "" {
+		rule += "=" + fe.Param()
+	}
+	return fmt.Errorf("%s breaks rule %s", strings.ToLower(fe.Field()), rule)
+}
+
+// LoadCatalog reads products from path, choosing the format by its
+// extension. Every product is validated, and a repeated id fails the load.
+func LoadCatalog(path string) ([]Product, error) {
+	format, err := ParseCatalogFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	products, err := ReadCatalog(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return products, nil
+}
+
+// ReadCatalog reads and validates products in format from r.
+func ReadCatalog(r io.Reader, format CatalogFormat) ([]Product, error) {
+	switch format {
+	case CatalogJSON:
+		return readCatalogJSON(r)
+	case CatalogCSV:
+		return readCatalogCSV(r)
+	default:
+		return nil, fmt.Errorf("unknown catalog format %q", format)
+	}
+}
+
+func readCatalogJSON(r io.Reader) ([]Product, error) {
+	var products []Product
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&products); err != nil {
+		return nil, fmt.Errorf("parsing catalog: %w", err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("parsing catalog: unexpected data after the product array")
+	}
+
+	seen := make(map[string]int, len(products))
+	for i, p := range products {
+		if err := validateProduct(p); err != nil {
+			return nil, fmt.Errorf("product %d: %w", i, err)
+		}
+		if first, ok := seen[p.ID]; ok {
+			return nil, fmt.Errorf("product %d: duplicate id %q, first used by product %d", i, p.ID, first)
+		}
+		seen[p.ID] = i
+	}
+	return products, nil
+}
+
+func readCatalogCSV(r io.Reader) ([]Product, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("catalog has no header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(catalogColumns, name) {
+			return nil, fmt.Errorf("line 1: unknown column %q", name)
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("line 1: duplicate column %q", name)
+		}
+		columns[name] = i
+	}
+	for _, name := range requiredCatalogColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("line 1: missing column %q", name)
+		}
+	}
+
+	products := []Product{}
+	seen := make(map[string]int)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		price, err := ParseMoney(field("price"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		p := Product{
+			ID:       field("id"),
+			Name:     field("name"),
+			Category: field("category"),
+			Price:    price,
+			Image: Image{
+				Thumbnail: field("thumbnail"),
+				Mobile:    field("mobile"),
+				Tablet:    field("tablet"),
+				Desktop:   field("desktop"),
+			},
+		}
+		if err := validateProduct(p); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if first, ok := seen[p.ID]; ok {
+			return nil, fmt.Errorf("line %d: duplicate id %q, first used on line %d", line, p.ID, first)
+		}
+		seen[p.ID] = line
+		products = append(products, p)
+	}
+	return products, nil
+}
+
+// WriteCatalog writes products in format, in a form ReadCatalog accepts.
+func WriteCatalog(w io.Writer, format CatalogFormat, products []Product) error {
+	switch format {
+	case CatalogJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if products == nil {
+			products = []Product{}
+		}
+		return enc.Encode(products)
+	case CatalogCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(catalogColumns); err != nil {
+			return err
+		}
+		for _, p := range products {
+			record := []string{p.ID, p.Name, p.Category, p.Price.String(),
+				p.Image.Thumbnail, p.Image.Mobile, p.Image.Tablet, p.Image.Desktop}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown catalog format %q", format)
+	}
+}
@@ -0,0 +1,88 @@
+package data
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCatalog_RoundTrip(t *testing.T) {
+	for _, format := range []CatalogFormat{CatalogJSON, CatalogCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteCatalog(&buf, format, DefaultProducts()); err != nil {
+				t.Fatalf("WriteCatalog error: %v", err)
+			}
+			path := filepath.Join(t.TempDir(), "products."+string(format))
+			if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+				t.Fatalf("failed to write catalog: %v", err)
+			}
+
+			got, err := LoadCatalog(path)
+			if err != nil {
+				t.Fatalf("LoadCatalog error: %v", err)
+			}
+			if !reflect.DeepEqual(got, DefaultProducts()) {
+				t.Errorf("LoadCatalog returned %d products that differ from the ones written", len(got))
+			}
+		})
+	}
+}
+
+func TestReadCatalog_CSVColumns(t *testing.T) {
+	// Columns may come in any order and the image columns are optional.
+	csv := "price,name,id,category\n4.5,Lemon Tart,10,Tart\n"
+	got, err := ReadCatalog(strings.NewReader(csv), CatalogCSV)
+	if err != nil {
+		t.Fatalf("ReadCatalog error: %v", err)
+	}
+	want := []Product{{ID: "10", Name: "Lemon Tart", Category: "Tart", Price: 450}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadCatalog = %+v, want %+v", got, want)
+	}
+}
+
+func TestReadCatalog_Rejects(t *testing.T) {
+	cases := []struct {
+		name   string
+		format CatalogFormat
+		in     string
+		want   string
+	}{
+		{"csv duplicate id", CatalogCSV, "id,name,category,price\n1,A,X,1\n2,B,X,1\n1,C,X,1\n", `line 4: duplicate id "1", first used on line 2`},
+		{"csv bad price", CatalogCSV, "id,name,category,price\n1,A,X,1.234\n", "line 2: invalid amount"},
+		{"csv zero price", CatalogCSV, "id,name,category,price\n1,A,X,0\n", "line 2: price breaks rule gt=0"},
+		{"csv price too large", CatalogCSV, "id,name,category,price\n1,A,X,1000000.01\n", "line 2: price breaks rule max=100000000"},
+		{"csv price overflows", CatalogCSV, "id,name,category,price\n1,A,X,184467440737095517\n", "line 2: amount \"184467440737095517\" is too large"},
+		{"csv empty name", CatalogCSV, "id,name,category,price\n1,,X,1\n", "line 2: name breaks rule required"},
+		{"csv bad url", CatalogCSV, "id,name,category,price,mobile\n1,A,X,1,not a url\n", "line 2: mobile breaks rule url"},
+		{"csv unknown column", CatalogCSV, "id,name,category,price,colour\n", `unknown column "colour"`},
+		{"csv missing column", CatalogCSV, "id,name,category\n", `missing column "price"`},
+		{"csv short row", CatalogCSV, "id,name,category,price\n1,A,X\n", "wrong number of fields"},
+		{"json duplicate id", CatalogJSON, `[{"id":"1","name":"A","category":"X","price":1},{"id":"1","name":"B","category":"X","price":2}]`, `product 1: duplicate id "1"`},
+		{"json bad price", CatalogJSON, `[{"id":"1","name":"A","category":"X","price":1.234}]`, "invalid amount"},
+		{"json negative price", CatalogJSON, `[{"id":"1","name":"A","category":"X","price":-1}]`, "product 0: price breaks rule gt=0"},
+		{"json non-integer id", CatalogJSON, `[{"id":"one","name":"A","category":"X","price":1}]`, "product 0: id breaks rule number"},
+		{"json unknown field", CatalogJSON, `[{"id":"1","name":"A","category":"X","price":1,"stock":3}]`, "unknown field"},
+		{"json trailing data", CatalogJSON, `[] []`, "unexpected data"},
+	}
+	for _, tc := range cases {
+		_, err := ReadCatalog(strings.NewReader(tc.in), tc.format)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error = %v, want it to mention %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestLoadCatalog_UnknownExtension(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.yaml")
+	if err := os.WriteFile(path, []byte("[]"), 0o644); err != nil {
+		t.Fatalf("failed to write catalog: %v", err)
+	}
+	if _, err := LoadCatalog(path); err == nil {
+		t.Errorf("expected LoadCatalog to reject a .yaml file")
+	}
+}
@@ -0,0 +1,84 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in minor units (cents). It is encoded in JSON as a
+// decimal number with two fractional digits, so the wire format matches the
+// old float64 prices while arithmetic stays exact.
+type Money int64
+
+// maxWholeUnits is the largest whole part ParseMoney accepts, so that the
+// amount in cents still fits in a Money.
+const maxWholeUnits = (math.MaxInt64 - 99) / 100
+
+// ParseMoney parses a decimal amount such as "6.5", "6.50" or "7" without
+// going through float64. Amounts too large for Money are rejected.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole == "" || (hasFrac && (frac == "" || len(frac) > 2)) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	units, err := strconv.ParseUint(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if units > maxWholeUnits {
+		return 0, fmt.Errorf("amount %q is too large", s)
+	}
+	cents, err := strconv.ParseUint(frac, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	m := Money(units*100 + cents)
+	if neg {
+		m = -m
+	}
+	return m, nil
+}
+
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+		m = -m
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, m/100, m%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Times returns the amount multiplied by a quantity.
+func (m Money) Times(quantity int) Money {
+	return m * Money(quantity)
+}
+
+// BasisPoints returns the amount scaled by bps/10000, rounded half up.
+func (m Money) BasisPoints(bps int) Money {
+	return (m*Money(bps) + 5000) / 10000
+}
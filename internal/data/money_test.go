@@ -0,0 +1,72 @@
+package data
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{"6.5", 650, false},
+		{"6.50", 650, false},
+		{"7", 700, false},
+		{"0.05", 5, false},
+		{"-1.25", -125, false},
+		{"1.234", 0, true},
+		{"1.", 0, true},
+		{".5", 0, true},
+		{"abc", 0, true},
+		{"92233720368547757.99", Money(math.MaxInt64 - 8), false},
+		{"-92233720368547757.99", -Money(math.MaxInt64 - 8), false},
+		{"92233720368547758", 0, true},
+		{"184467440737095517", 0, true},
+		{"4000000000000000000", 0, true},
+		{"18446744073709551616", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParseMoney(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Fatalf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoney_JSONRoundTrip(t *testing.T) {
+	b, err := json.Marshal(struct {
+		Price Money `json:"price"`
+	}{Price: 650})
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+	if string(b) != `{"price":6.50}` {
+		t.Fatalf("marshal = %s, want %s", b, `{"price":6.50}`)
+	}
+
+	var decoded struct {
+		Price Money `json:"price"`
+	}
+	if err := json.Unmarshal([]byte(`{"price":4.5}`), &decoded); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if decoded.Price != 450 {
+		t.Fatalf("unmarshal price = %d, want 450", decoded.Price)
+	}
+}
+
+func TestMoney_BasisPointsRoundsHalfUp(t *testing.T) {
+	if got := Money(1000).BasisPoints(825); got != 83 {
+		t.Fatalf("1000 @ 825bps = %d, want 83", got)
+	}
+	if got := Money(650).BasisPoints(1000); got != 65 {
+		t.Fatalf("650 @ 1000bps = %d, want 65", got)
+	}
+}
@@ -1,22 +1,26 @@
 package data
 
+import "slices"
+
 type Image struct {
-	Thumbnail string `json:"thumbnail"`
-	Mobile    string `json:"mobile"`
-	Tablet    string `json:"tablet"`
-	Desktop   string `json:"desktop"`
+	Thumbnail string `json:"thumbnail" validate:"omitempty,url"`
+	Mobile    string `json:"mobile" validate:"omitempty,url"`
+	Tablet    string `json:"tablet" validate:"omitempty,url"`
+	Desktop   string `json:"desktop" validate:"omitempty,url"`
 }
 
 type Product struct {
-	ID       string  `json:"id"`
-	Image    Image   `json:"image"`
-	Name     string  `json:"name"`
-	Category string  `json:"category"`
-	Price    float64 `json:"price"`
+	ID       string `json:"id" validate:"required,number,max=18"`
+	Image    Image  `json:"image"`
+	Name     string `json:"name" validate:"required,max=100"`
+	Category string `json:"category" validate:"required,max=50"`
+	// Price is capped at 1,000,000.00 so that a full order of 100 items of
+	// 1000 units each stays far from overflowing Money.
+	Price Money `json:"price" validate:"gt=0,max=100000000"`
 }
 
-// private in-memory list (simulate DB)
-var products = []Product{
+// defaultProducts is the menu the product stores are seeded with.
+var defaultProducts = []Product{
 	{
 		ID: "1",
 		Image: Image{
@@ -27,7 +31,7 @@ var products = []Product{
 		},
 		Name:     "Waffle with Berries",
 		Category: "Waffle",
-		Price:    6.5,
+		Price:    650,
 	},
 	{
 		ID: "2",
@@ -39,7 +43,7 @@ var products = []Product{
 		},
 		Name:     "Vanilla Bean Crème Brûlée",
 		Category: "Crème Brûlée",
-		Price:    7.0,
+		Price:    700,
 	},
 	{
 		ID: "3",
@@ -51,7 +55,7 @@ var products = []Product{
 		},
 		Name:     "Macaron Mix of Five",
 		Category: "Macaron",
-		Price:    8.0,
+		Price:    800,
 	},
 	{
 		ID: "4",
@@ -63,7 +67,7 @@ var products = []Product{
 		},
 		Name:     "Classic Tiramisu",
 		Category: "Tiramisu",
-		Price:    5.5,
+		Price:    550,
 	},
 	{
 		ID: "5",
@@ -75,7 +79,7 @@ var products = []Product{
 		},
 		Name:     "Pistachio Baklava",
 		Category: "Baklava",
-		Price:    4.0,
+		Price:    400,
 	},
 	{
 		ID: "6",
@@ -87,7 +91,7 @@ var products = []Product{
 		},
 		Name:     "Lemon Meringue Pie",
 		Category: "Pie",
-		Price:    5.0,
+		Price:    500,
 	},
 	{
 		ID: "7",
@@ -99,7 +103,7 @@ var products = []Product{
 		},
 		Name:     "Red Velvet Cake",
 		Category: "Cake",
-		Price:    4.5,
+		Price:    450,
 	},
 	{
 		ID: "8",
@@ -111,7 +115,7 @@ var products = []Product{
 		},
 		Name:     "Salted Caramel Brownie",
 		Category: "Brownie",
-		Price:    4.5,
+		Price:    450,
 	},
 	{
 		ID: "9",
@@ -123,20 +127,11 @@ var products = []Product{
 		},
 		Name:     "Vanilla Panna Cotta",
 		Category: "Panna Cotta",
-		Price:    6.5,
+		Price:    650,
 	},
 }
 
-// exported functions — can later call DB instead
-func GetAllProducts() []Product {
-	return products
-}
-
-func GetProductByID(id string) (Product, bool) {
-	for _, p := range products {
-		if p.ID == id {
-			return p, true
-		}
-	}
-	return Product{}, false
+// DefaultProducts returns a copy of the built-in menu.
+func DefaultProducts() []Product {
+	return slices.Clone(defaultProducts)
 }
@@ -0,0 +1,315 @@
+package data
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PerumallaGiridhar/oolio/internal/index"
+	"github.com/cockroachdb/pebble"
+)
+
+var (
+	ErrProductNotFound = errors.New("product not found")
+	ErrProductExists   = errors.New("product already exists")
+)
+
+// ProductRepository is where the menu is kept. List returns products
+// ordered by ID. Create fails with ErrProductExists for a taken ID, and
+// Update and Delete with ErrProductNotFound for a missing one.
+type ProductRepository interface {
+	List() ([]Product, error)
+	Get(id string) (Product, error)
+	Create(p Product) error
+	Update(p Product) error
+	Delete(id string) error
+}
+
+// ProductStore selects the ProductRepository the server uses.
+type ProductStore string
+
+const (
+	// ProductStoreMemory serves the built-in menu from memory.
+	ProductStoreMemory ProductStore = "memory"
+	// ProductStorePebble keeps the menu in the Pebble database, seeded
+	// with the built-in menu the first time it is opened, or replaced by
+	// the catalog file on every start when one is configured.
+	ProductStorePebble ProductStore = "pebble"
+)
+
+func ParseProductStore(s string) (ProductStore, error) {
+	switch store := ProductStore(strings.ToLower(strings.TrimSpace(s))); store {
+	case ProductStoreMemory, ProductStorePebble:
+		return store, nil
+	default:
+		return "", fmt.Errorf("unknown product store %q", s)
+	}
+}
+
+// compareProductIDs orders numeric IDs by value, so "10" follows "9".
+func compareProductIDs(a, b string) int {
+	x, errX := strconv.Atoi(a)
+	y, errY := strconv.Atoi(b)
+	if errX == nil && errY == nil {
+		return cmp.Compare(x, y)
+	}
+	return strings.Compare(a, b)
+}
+
+func sortProducts(products []Product) {
+	slices.SortFunc(products, func(a, b Product) int { return compareProductIDs(a.ID, b.ID) })
+}
+
+// MemoryProductRepository keeps products in a map. It is safe for
+// concurrent use.
+type MemoryProductRepository struct {
+	mu       sync.RWMutex
+	products map[string]Product
+}
+
+func NewMemoryProductRepository(products []Product) *MemoryProductRepository {
+	r := &MemoryProductRepository{products: make(map[string]Product, len(products))}
+	for _, p := range products {
+		r.products[p.ID] = p
+	}
+	return r
+}
+
+func (r *MemoryProductRepository) List() ([]Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	products := make([]Product, 0, len(r.products))
+	for _, p := range r.products {
+		products = append(products, p)
+	}
+	sortProducts(products)
+	return products, nil
+}
+
+func (r *MemoryProductRepository) Get(id string) (Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.products[id]
+	if !ok {
+		return Product{}, ErrProductNotFound
+	}
+	return p, nil
+}
+
+func (r *MemoryProductRepository) Create(p Product) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.products[p.ID]; ok {
+		return ErrProductExists
+	}
+	r.products[p.ID] = p
+	return nil
+}
+
+func (r *MemoryProductRepository) Update(p Product) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.products[p.ID]; !ok {
+		return ErrProductNotFound
+	}
+	r.products[p.ID] = p
+	return nil
+}
+
+func (r *MemoryProductRepository) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.products[id]; !ok {
+		return ErrProductNotFound
+	}
+	delete(r.products, id)
+	return nil
+}
+
+// PebbleProductRepository stores products as JSON under the "product/" key
+// prefix.
+type PebbleProductRepository struct {
+	db *pebble.DB
+	// mu serializes writes, so checking whether an ID is taken and writing
+	// it happen together.
+	mu sync.Mutex
+}
+
+const productKeyPrefix = "product/"
+
+// productsSeededKey marks a database whose menu has been seeded, so a menu
+// that was emptied on purpose is not seeded again. '-' sorts before '/', so
+// it stays outside the product range.
+var productsSeededKey = []byte("product-seeded")
+
+// NewPebbleProductRepository stores products in db, writing seed the first
+// time db is used for products.
+func NewPebbleProductRepository(db *pebble.DB, seed []Product) (*PebbleProductRepository, error) {
+	r := &PebbleProductRepository{db: db}
+	_, closer, err := db.Get(productsSeededKey)
+	if err == nil {
+		closer.Close()
+		return r, nil
+	}
+	if !errors.Is(err, pebble.ErrNotFound) {
+		return nil, err
+	}
+
+	batch := db.NewBatch()
+	defer batch.Close()
+	for _, p := range seed {
+		value, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		if err := batch.Set(productKey(p.ID), value, nil); err != nil {
+			return nil, err
+		}
+	}
+	if err := batch.Set(productsSeededKey, nil, nil); err != nil {
+		return nil, err
+	}
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return nil, fmt.Errorf("seeding products: %w", err)
+	}
+	log.Printf("seeded product store with %d products", len(seed))
+	return r, nil
+}
+
+// Replace swaps the whole stored menu for products in one batch, for a
+// catalog file that should win over whatever was stored before.
+func (r *PebbleProductRepository) Replace(products []Product) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	batch := r.db.NewBatch()
+	defer batch.Close()
+	if err := batch.DeleteRange([]byte(productKeyPrefix), index.PrefixUpperBound(productKeyPrefix), nil); err != nil {
+		return err
+	}
+	for _, p := range products {
+		value, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		if err := batch.Set(productKey(p.ID), value, nil); err != nil {
+			return err
+		}
+	}
+	if err := batch.Set(productsSeededKey, nil, nil); err != nil {
+		return err
+	}
+	return batch.Commit(pebble.Sync)
+}
+
+func productKey(id string) []byte {
+	return []byte(productKeyPrefix + id)
+}
+
+func (r *PebbleProductRepository) Get(id string) (Product, error) {
+	value, closer, err := r.db.Get(productKey(id))
+	if errors.Is(err, pebble.ErrNotFound) {
+		return Product{}, ErrProductNotFound
+	}
+	if err != nil {
+		return Product{}, err
+	}
+	defer closer.Close()
+
+	var p Product
+	if err := json.Unmarshal(value, &p); err != nil {
+		return Product{}, err
+	}
+	return p, nil
+}
+
+func (r *PebbleProductRepository) List() ([]Product, error) {
+	iter, err := r.db.NewIter(&pebble.IterOptions{
+		LowerBound: []byte(productKeyPrefix),
+		UpperBound: index.PrefixUpperBound(productKeyPrefix),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	products := []Product{}
+	for iter.First(); iter.Valid(); iter.Next() {
+		var p Product
+		if err := json.Unmarshal(iter.Value(), &p); err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	sortProducts(products)
+	return products, nil
+}
+
+// exists reports whether id is stored.
+func (r *PebbleProductRepository) exists(id string) (bool, error) {
+	_, closer, err := r.db.Get(productKey(id))
+	if errors.Is(err, pebble.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	closer.Close()
+	return true, nil
+}
+
+func (r *PebbleProductRepository) put(p Product) error {
+	value, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return r.db.Set(productKey(p.ID), value, pebble.Sync)
+}
+
+func (r *PebbleProductRepository) Create(p Product) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	found, err := r.exists(p.ID)
+	if err != nil {
+		return err
+	}
+	if found {
+		return ErrProductExists
+	}
+	return r.put(p)
+}
+
+func (r *PebbleProductRepository) Update(p Product) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	found, err := r.exists(p.ID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrProductNotFound
+	}
+	return r.put(p)
+}
+
+func (r *PebbleProductRepository) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	found, err := r.exists(id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrProductNotFound
+	}
+	return r.db.Delete(productKey(id), pebble.Sync)
+}
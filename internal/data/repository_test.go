@@ -0,0 +1,136 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/PerumallaGiridhar/oolio/internal/index"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+func openTestDB(t *testing.T, fs vfs.FS) *pebble.DB {
+	t.Helper()
+	db, err := pebble.Open("products", &pebble.Options{FS: fs})
+	if err != nil {
+		t.Fatalf("failed to open pebble: %v", err)
+	}
+	return db
+}
+
+func TestProductRepositories_GetAndList(t *testing.T) {
+	db := openTestDB(t, vfs.NewMem())
+	t.Cleanup(func() { db.Close() })
+	seed := append(DefaultProducts(), Product{ID: "10", Name: "Lemon Tart", Category: "Tart", Price: 500})
+
+	pebbleRepo, err := NewPebbleProductRepository(db, seed)
+	if err != nil {
+		t.Fatalf("NewPebbleProductRepository error: %v", err)
+	}
+	repos := map[string]ProductRepository{
+		"memory": NewMemoryProductRepository(seed),
+		"pebble": pebbleRepo,
+	}
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			p, err := repo.Get("1")
+			if err != nil || p.Name != "Waffle with Berries" || p.Price != 650 {
+				t.Errorf("Get(1) = %+v, %v; want the waffle", p, err)
+			}
+			if _, err := repo.Get("999"); !errors.Is(err, ErrProductNotFound) {
+				t.Errorf("Get(999) error = %v, want ErrProductNotFound", err)
+			}
+
+			list, err := repo.List()
+			if err != nil {
+				t.Fatalf("List error: %v", err)
+			}
+			if len(list) != 10 || list[0].ID != "1" || list[8].ID != "9" || list[9].ID != "10" {
+				t.Errorf("List returned %d products, want 1..10 in order", len(list))
+			}
+
+			tart := Product{ID: "11", Name: "Lime Tart", Category: "Tart", Price: 550}
+			if err := repo.Update(tart); !errors.Is(err, ErrProductNotFound) {
+				t.Errorf("Update(missing) error = %v, want ErrProductNotFound", err)
+			}
+			if err := repo.Create(tart); err != nil {
+				t.Fatalf("Create error: %v", err)
+			}
+			if err := repo.Create(tart); !errors.Is(err, ErrProductExists) {
+				t.Errorf("second Create error = %v, want ErrProductExists", err)
+			}
+			tart.Price = 600
+			if err := repo.Update(tart); err != nil {
+				t.Fatalf("Update error: %v", err)
+			}
+			if p, err := repo.Get("11"); err != nil || p.Price != 600 {
+				t.Errorf("Get(11) = %+v, %v; want the updated tart", p, err)
+			}
+			if err := repo.Delete("11"); err != nil {
+				t.Fatalf("Delete error: %v", err)
+			}
+			if err := repo.Delete("11"); !errors.Is(err, ErrProductNotFound) {
+				t.Errorf("second Delete error = %v, want ErrProductNotFound", err)
+			}
+		})
+	}
+}
+
+func TestPebbleProductRepository_SeedsOnce(t *testing.T) {
+	fs := vfs.NewMem()
+	db := openTestDB(t, fs)
+	if _, err := NewPebbleProductRepository(db, DefaultProducts()); err != nil {
+		t.Fatalf("NewPebbleProductRepository error: %v", err)
+	}
+	// Emptying the menu must survive a restart.
+	if err := db.DeleteRange([]byte(productKeyPrefix), index.PrefixUpperBound(productKeyPrefix), pebble.Sync); err != nil {
+		t.Fatalf("DeleteRange error: %v", err)
+	}
+	db.Close()
+
+	db = openTestDB(t, fs)
+	t.Cleanup(func() { db.Close() })
+	repo, err := NewPebbleProductRepository(db, DefaultProducts())
+	if err != nil {
+		t.Fatalf("NewPebbleProductRepository error: %v", err)
+	}
+	if list, err := repo.List(); err != nil || len(list) != 0 {
+		t.Errorf("List = %d products, %v; want the emptied menu", len(list), err)
+	}
+}
+
+func TestPebbleProductRepository_Replace(t *testing.T) {
+	db := openTestDB(t, vfs.NewMem())
+	t.Cleanup(func() { db.Close() })
+	repo, err := NewPebbleProductRepository(db, DefaultProducts())
+	if err != nil {
+		t.Fatalf("NewPebbleProductRepository error: %v", err)
+	}
+
+	catalog := []Product{
+		{ID: "2", Name: "Vanilla Bean Crème Brûlée", Category: "Crème Brûlée", Price: 700},
+		{ID: "10", Name: "Lemon Tart", Category: "Tart", Price: 500},
+	}
+	if err := repo.Replace(catalog); err != nil {
+		t.Fatalf("Replace error: %v", err)
+	}
+	list, err := repo.List()
+	if err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	if len(list) != 2 || list[0].ID != "2" || list[0].Price != 700 || list[1].ID != "10" {
+		t.Errorf("List = %+v, want only the replacement catalog", list)
+	}
+	if _, err := repo.Get("1"); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("Get(1) error = %v, want ErrProductNotFound after Replace", err)
+	}
+}
+
+func TestParseProductStore(t *testing.T) {
+	if store, err := ParseProductStore(" Memory "); err != nil || store != ProductStoreMemory {
+		t.Errorf("ParseProductStore(memory) = %q, %v", store, err)
+	}
+	if _, err := ParseProductStore("redis"); err == nil {
+		t.Errorf("expected ParseProductStore to reject redis")
+	}
+}
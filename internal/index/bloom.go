@@ -2,65 +2,144 @@ package index
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
+	"log"
+	"math"
 	"os"
 
 	"github.com/willf/bloom"
 )
 
-func countPromos(srcPath string) (int, error) {
+// Bloom filter files are laid out as a fixed little-endian header, the
+// filter's bit array as 64-bit words, and a CRC-32C of everything before
+// it. The header records what the filter was built from, so a filter for
+// another version of the source, another size or another normalization is
+// rebuilt rather than trusted.
+const (
+	bloomFileMagic   = "OBLM"
+	bloomFileVersion = 2
+)
+
+type bloomFileHeader struct {
+	Magic                [4]byte
+	Version              uint32
+	NormalizationVersion uint32
+	NormalizationHash    uint64
+	K                    uint32
+	Count                uint64
+	FalsePositiveRate    float64
+	Words                uint64
+	SourceSHA256         [32]byte
+}
+
+var (
+	errBloomStale   = errors.New("bloom filter is stale")
+	errBloomCorrupt = errors.New("bloom filter is corrupt")
+	// errBloomSourceChanged means the source no longer hashes to the
+	// checksum the filter was requested for, so the filter would not match
+	// the store built from it.
+	errBloomSourceChanged = errors.New("bloom filter source changed while building")
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// defaultBloomFalsePositiveRate is used by BuildOrLoadBloomFilter.
+const defaultBloomFalsePositiveRate = 0.001
+
+// scanPromos returns the number of lines in srcPath and its SHA-256.
+func scanPromos(srcPath string) (int, string, error) {
 	file, err := os.Open(srcPath)
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
 	defer file.Close()
 
-	scan := bufio.NewScanner(file)
+	h := sha256.New()
+	scan := bufio.NewScanner(io.TeeReader(file, h))
 	scan.Buffer(make([]byte, 1024), 64*1024)
 
 	promoCount := 0
 	for scan.Scan() {
 		promoCount++
 	}
+	if err := scan.Err(); err != nil {
+		return 0, "", err
+	}
+
+	return promoCount, hex.EncodeToString(h.Sum(nil)), nil
+}
 
-	return promoCount, nil
+// newBloomHeader describes the filter wanted for n codes of the source with
+// checksum sha, normalized with policy, at false-positive rate fp.
+func newBloomHeader(sha string, n uint, fp float64, policy Policy) (bloomFileHeader, error) {
+	hdr := bloomFileHeader{
+		Version:              bloomFileVersion,
+		NormalizationVersion: NormalizationVersion,
+		NormalizationHash:    policy.normalizationHash(),
+		Count:                uint64(n),
+		FalsePositiveRate:    fp,
+	}
+	copy(hdr.Magic[:], bloomFileMagic)
+	if _, err := hex.Decode(hdr.SourceSHA256[:], []byte(sha)); err != nil {
+		return bloomFileHeader{}, fmt.Errorf("invalid source checksum %q: %w", sha, err)
+	}
+	m, k := bloom.EstimateParameters(n, fp)
+	hdr.Words = uint64(max(m, 1)+63) / 64
+	hdr.K = uint32(max(k, 1))
+	return hdr, nil
 }
 
-func buildBloomFilterFromFile(srcPath string) (*bloom.BloomFilter, error) {
+// buildBloomFilterFromFile returns the filter together with the words
+// backing its bit array, so they can be saved without re-encoding. It fails
+// with errBloomSourceChanged when the contents it read do not hash to
+// hdr.SourceSHA256, so a filter is never kept for a store built from
+// another version of the source.
+func buildBloomFilterFromFile(srcPath string, hdr bloomFileHeader, policy Policy) (*bloom.BloomFilter, []uint64, error) {
 	file, err := os.Open(srcPath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer file.Close()
 
-	scan := bufio.NewScanner(file)
+	h := sha256.New()
+	scan := bufio.NewScanner(io.TeeReader(file, h))
 	scan.Buffer(make([]byte, 1024), 64*1024)
 
-	promoCount, err := countPromos(srcPath)
-	if err != nil {
-		return nil, err
-	}
-	bloomFilter := bloom.NewWithEstimates(uint(promoCount), 0.001)
-	for scan.Scan() {
-		promo := scan.Text()
-		if promo == "" {
+	words := make([]uint64, hdr.Words)
+	bloomFilter := bloom.From(words, uint(hdr.K))
+	for line := 1; scan.Scan(); line++ {
+		promo, _, ok, err := parseSourceLine(scan.Text(), policy)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s line %d: %w", srcPath, line, err)
+		}
+		if !ok {
 			continue
 		}
 		bloomFilter.AddString(promo)
 	}
-
-	return bloomFilter, scan.Err()
-
+	if err := scan.Err(); err != nil {
+		return nil, nil, err
+	}
+	if [32]byte(h.Sum(nil)) != hdr.SourceSHA256 {
+		return nil, nil, fmt.Errorf("%s: %w", srcPath, errBloomSourceChanged)
+	}
+	return bloomFilter, words, nil
 }
 
-func saveBloomFilter(bf *bloom.BloomFilter, dstPath string) error {
+func saveBloomFilter(hdr bloomFileHeader, words []uint64, dstPath string) error {
 	tmp := dstPath + ".tmp"
 	out, err := os.Create(tmp)
 	if err != nil {
 		return err
 	}
 
-	_, writeErr := bf.WriteTo(out)
+	writeErr := writeBloomFile(out, hdr, words)
 	closeErr := out.Close()
 
 	if writeErr != nil {
@@ -75,40 +154,128 @@ func saveBloomFilter(bf *bloom.BloomFilter, dstPath string) error {
 	return os.Rename(tmp, dstPath)
 }
 
-func loadBloomFilter(srcPath string) (*bloom.BloomFilter, error) {
+func writeBloomFile(out io.Writer, hdr bloomFileHeader, words []uint64) error {
+	crc := crc32.New(crc32c)
+	w := bufio.NewWriterSize(io.MultiWriter(out, crc), 1<<20)
+	if err := binary.Write(w, binary.LittleEndian, hdr); err != nil {
+		return err
+	}
+	var buf [8]byte
+	for _, word := range words {
+		binary.LittleEndian.PutUint64(buf[:], word)
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return binary.Write(out, binary.LittleEndian, crc.Sum32())
+}
+
+// loadBloomFilter reads the filter at srcPath, returning errBloomStale if
+// it was built for something other than want and errBloomCorrupt if it is
+// truncated or fails its checksum.
+func loadBloomFilter(srcPath string, want bloomFileHeader) (*bloom.BloomFilter, error) {
 	file, err := os.Open(srcPath)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	bf := &bloom.BloomFilter{}
-	if _, err := bf.ReadFrom(file); err != nil && err != io.EOF {
-		return nil, err
+	crc := crc32.New(crc32c)
+	br := bufio.NewReaderSize(file, 1<<20)
+	r := io.TeeReader(br, crc)
+
+	var hdr bloomFileHeader
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("%w: reading header: %v", errBloomCorrupt, err)
+	}
+	switch {
+	case string(hdr.Magic[:]) != bloomFileMagic:
+		return nil, fmt.Errorf("%w: not a bloom filter file", errBloomCorrupt)
+	case hdr.Version != bloomFileVersion:
+		return nil, fmt.Errorf("%w: file version %d, want %d", errBloomStale, hdr.Version, bloomFileVersion)
+	case hdr.NormalizationVersion != want.NormalizationVersion:
+		return nil, fmt.Errorf("%w: normalization version %d, want %d", errBloomStale, hdr.NormalizationVersion, want.NormalizationVersion)
+	case hdr.NormalizationHash != want.NormalizationHash:
+		return nil, fmt.Errorf("%w: built with a different code normalization", errBloomStale)
+	case hdr.SourceSHA256 != want.SourceSHA256:
+		return nil, fmt.Errorf("%w: source checksum changed", errBloomStale)
+	case hdr.Count != want.Count || math.Float64bits(hdr.FalsePositiveRate) != math.Float64bits(want.FalsePositiveRate):
+		return nil, fmt.Errorf("%w: sized for %d codes at %g, want %d at %g",
+			errBloomStale, hdr.Count, hdr.FalsePositiveRate, want.Count, want.FalsePositiveRate)
+	case hdr.Words != want.Words || hdr.K != want.K:
+		return nil, fmt.Errorf("%w: %d words and %d hashes, want %d and %d", errBloomCorrupt, hdr.Words, hdr.K, want.Words, want.K)
 	}
 
-	return bf, nil
+	words := make([]uint64, hdr.Words)
+	buf := make([]byte, 64<<10)
+	for i := 0; i < len(words); {
+		n := min(len(buf), (len(words)-i)*8)
+		if _, err := io.ReadFull(r, buf[:n]); err != nil {
+			return nil, fmt.Errorf("%w: reading bit array: %v", errBloomCorrupt, err)
+		}
+		for off := 0; off < n; off += 8 {
+			words[i] = binary.LittleEndian.Uint64(buf[off:])
+			i++
+		}
+	}
+
+	sum := crc.Sum32()
+	var stored uint32
+	if err := binary.Read(br, binary.LittleEndian, &stored); err != nil {
+		return nil, fmt.Errorf("%w: reading checksum: %v", errBloomCorrupt, err)
+	}
+	if stored != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", errBloomCorrupt)
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("%w: trailing data", errBloomCorrupt)
+	}
+
+	return bloom.From(words, uint(hdr.K)), nil
 }
 
-func BuildOrLoadBloomFilter(srcPath string) (*bloom.BloomFilter, error) {
+// BuildOrLoadBloomFilter returns the Bloom filter for srcPath with codes
+// normalized by policy, reusing <srcPath>.bloom when it matches the source
+// and policy.
+func BuildOrLoadBloomFilter(srcPath string, policy Policy) (*bloom.BloomFilter, error) {
+	promoCount, sha, err := scanPromos(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	return buildOrLoadBloomFilter(srcPath, sha, uint(promoCount), defaultBloomFalsePositiveRate, policy)
+}
+
+// buildOrLoadBloomFilter reuses <srcPath>.bloom when it was built from the
+// source with checksum sha, normalized with policy and sized for n codes at
+// false-positive rate fp. A missing, stale or corrupt file is replaced by a
+// freshly built filter.
+func buildOrLoadBloomFilter(srcPath, sha string, n uint, fp float64, policy Policy) (*bloom.BloomFilter, error) {
 	dstPath := srcPath + ".bloom"
 
-	srcStat, err := os.Stat(srcPath)
+	hdr, err := newBloomHeader(sha, n, fp, policy)
 	if err != nil {
 		return nil, err
 	}
 
-	if dstStat, err := os.Stat(dstPath); err == nil && srcStat.ModTime().Before(dstStat.ModTime()) {
-		bf, err := loadBloomFilter(dstPath)
-		return bf, err
+	bf, err := loadBloomFilter(dstPath, hdr)
+	switch {
+	case err == nil:
+		return bf, nil
+	case errors.Is(err, errBloomStale), errors.Is(err, errBloomCorrupt):
+		log.Printf("rebuilding bloom filter %s: %v", dstPath, err)
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
 	}
 
-	bf, err := buildBloomFilterFromFile(srcPath)
+	bf, words, err := buildBloomFilterFromFile(srcPath, hdr, policy)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := saveBloomFilter(bf, dstPath); err != nil {
+	if err := saveBloomFilter(hdr, words, dstPath); err != nil {
 		return nil, err
 	}
 
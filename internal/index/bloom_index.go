@@ -0,0 +1,95 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/willf/bloom"
+)
+
+// BloomIndex keeps one Bloom filter per source in memory. It uses far less
+// memory than MemoryIndex but a code can be reported valid when it is not
+// (about 0.1% of the time per source).
+type BloomIndex struct {
+	Filters []*bloom.BloomFilter
+	Quorum  int
+	// Policy normalizes codes and rejects malformed ones before the
+	// filters are tested.
+	Policy Policy
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewBloomIndex builds or loads the <path>.bloom filter for every source,
+// with codes normalized by policy.
+func NewBloomIndex(paths []string, quorum int, policy Policy) (*BloomIndex, error) {
+	if err := CheckQuorum(paths, quorum); err != nil {
+		return nil, err
+	}
+
+	filters := make([]*bloom.BloomFilter, len(paths))
+	for i, path := range paths {
+		bf, err := BuildOrLoadBloomFilter(strings.TrimSpace(path), policy)
+		if err != nil {
+			return nil, fmt.Errorf("bloom filter for %q: %w", path, err)
+		}
+		filters[i] = bf
+	}
+	return &BloomIndex{Filters: filters, Quorum: quorum, Policy: policy}, nil
+}
+
+// IsValid reports whether at least bi.Quorum filters may contain code.
+func (bi *BloomIndex) IsValid(ctx context.Context, code string) (bool, error) {
+	status, err := bi.Lookup(ctx, code, time.Now())
+	return status == StatusActive, err
+}
+
+// Lookup reports StatusActive when at least bi.Quorum filters may contain
+// code. Filters do not keep validity windows, so codes never expire.
+func (bi *BloomIndex) Lookup(ctx context.Context, code string, _ time.Time) (Status, error) {
+	ok, err := bi.test(ctx, code)
+	if !ok || err != nil {
+		return StatusInvalid, err
+	}
+	return StatusActive, nil
+}
+
+func (bi *BloomIndex) test(ctx context.Context, code string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	code, ok := bi.Policy.Canonical(code)
+	if !ok {
+		return false, nil
+	}
+
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+	if bi.closed {
+		return false, ErrClosed
+	}
+	hits := 0
+	for i, bf := range bi.Filters {
+		if hits+len(bi.Filters)-i < bi.Quorum {
+			return false, nil
+		}
+		if bf.TestString(code) {
+			hits++
+			if hits >= bi.Quorum {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (bi *BloomIndex) Close() {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	bi.closed = true
+	bi.Filters = nil
+}
@@ -0,0 +1,116 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func bloomWantHeader(t *testing.T, srcPath string) bloomFileHeader {
+	t.Helper()
+	n, sha, err := scanPromos(srcPath)
+	if err != nil {
+		t.Fatalf("scanPromos error: %v", err)
+	}
+	hdr, err := newBloomHeader(sha, uint(n), defaultBloomFalsePositiveRate, Policy{})
+	if err != nil {
+		t.Fatalf("newBloomHeader error: %v", err)
+	}
+	return hdr
+}
+
+func TestBuildOrLoadBloomFilter_SavesAndReloads(t *testing.T) {
+	srcPath := writeTxtFile(t, t.TempDir(), "codes.txt", []string{"happyhrs", "FIFTYOFF"})
+
+	bf, err := BuildOrLoadBloomFilter(srcPath, Policy{})
+	if err != nil {
+		t.Fatalf("BuildOrLoadBloomFilter error: %v", err)
+	}
+	if !bf.TestString("HAPPYHRS") {
+		t.Errorf("expected HAPPYHRS in built filter")
+	}
+
+	loaded, err := loadBloomFilter(srcPath+".bloom", bloomWantHeader(t, srcPath))
+	if err != nil {
+		t.Fatalf("loadBloomFilter error: %v", err)
+	}
+	if !loaded.Equal(bf) {
+		t.Errorf("loaded filter differs from the one built")
+	}
+}
+
+func TestBuildOrLoadBloomFilter_RebuildsBadFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		damage  func(t *testing.T, srcPath, bloomPath string)
+		wantErr error
+	}{
+		{"truncated", func(t *testing.T, _, bloomPath string) {
+			info, _ := os.Stat(bloomPath)
+			if err := os.Truncate(bloomPath, info.Size()-9); err != nil {
+				t.Fatal(err)
+			}
+		}, errBloomCorrupt},
+		{"flipped bit", func(t *testing.T, _, bloomPath string) {
+			data, _ := os.ReadFile(bloomPath)
+			data[len(data)-10] ^= 0x01
+			if err := os.WriteFile(bloomPath, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}, errBloomCorrupt},
+		{"old format", func(t *testing.T, _, bloomPath string) {
+			if err := os.WriteFile(bloomPath, []byte{0, 0, 0, 0, 0, 0, 0, 64, 0, 0, 0, 0, 0, 0, 0, 3}, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}, errBloomCorrupt},
+		{"source changed", func(t *testing.T, srcPath, _ string) {
+			if err := os.WriteFile(srcPath, []byte("HAPPYHRS\nNEWCODE1\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}, errBloomStale},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcPath := writeTxtFile(t, t.TempDir(), "codes.txt", []string{"HAPPYHRS", "FIFTYOFF"})
+			bloomPath := srcPath + ".bloom"
+			if _, err := BuildOrLoadBloomFilter(srcPath, Policy{}); err != nil {
+				t.Fatalf("BuildOrLoadBloomFilter error: %v", err)
+			}
+
+			tt.damage(t, srcPath, bloomPath)
+			if _, err := loadBloomFilter(bloomPath, bloomWantHeader(t, srcPath)); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("loadBloomFilter error = %v, want %v", err, tt.wantErr)
+			}
+
+			bf, err := BuildOrLoadBloomFilter(srcPath, Policy{})
+			if err != nil {
+				t.Fatalf("BuildOrLoadBloomFilter after damage error: %v", err)
+			}
+			if !bf.TestString("HAPPYHRS") {
+				t.Errorf("expected HAPPYHRS in rebuilt filter")
+			}
+			if _, err := loadBloomFilter(bloomPath, bloomWantHeader(t, srcPath)); err != nil {
+				t.Errorf("rebuilt file does not load: %v", err)
+			}
+		})
+	}
+}
+
+func TestBuildOrLoadBloomFilter_SourceChangedSinceStoreBuilt(t *testing.T) {
+	srcPath := writeTxtFile(t, t.TempDir(), "codes.txt", []string{"HAPPYHRS"})
+	hdr := bloomWantHeader(t, srcPath)
+	sha := fmt.Sprintf("%x", hdr.SourceSHA256)
+
+	// The store was built from the old contents; the file changed since.
+	if err := os.WriteFile(srcPath, []byte("HAPPYHRS\nNEWCODE1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildOrLoadBloomFilter(srcPath, sha, 1, defaultBloomFalsePositiveRate, Policy{}); !errors.Is(err, errBloomSourceChanged) {
+		t.Fatalf("error = %v, want errBloomSourceChanged", err)
+	}
+	if _, err := os.Stat(srcPath + ".bloom"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no filter to be saved, stat error = %v", err)
+	}
+}
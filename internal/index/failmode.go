@@ -0,0 +1,66 @@
+package index
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrUnavailable is returned when stores failed and the ones that answered
+// cannot settle a lookup on their own.
+var ErrUnavailable = errors.New("promo stores unavailable")
+
+// FailMode decides the answer when failed stores leave a lookup unsettled.
+// Lookups always continue over the stores that answer, so a code that
+// reaches the quorum among healthy stores is active either way.
+type FailMode string
+
+const (
+	// FailClosed returns ErrUnavailable, so the code is not accepted.
+	FailClosed FailMode = "closed"
+	// FailOpen reports the code as active, so an unhealthy store never
+	// blocks orders.
+	FailOpen FailMode = "open"
+)
+
+func ParseFailMode(s string) (FailMode, error) {
+	switch mode := FailMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case FailClosed, FailOpen:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown promo fail mode %q", s)
+	}
+}
+
+// LookupStats counts lookups affected by failing stores.
+type LookupStats struct {
+	// StoreErrors counts failed reads from a single store.
+	StoreErrors int64 `json:"storeErrors"`
+	// Degraded lookups were settled by the stores that answered.
+	Degraded int64 `json:"degraded"`
+	// FailedOpen lookups were unsettled and reported as active.
+	FailedOpen int64 `json:"failedOpen"`
+	// Unavailable lookups were unsettled and returned ErrUnavailable.
+	Unavailable int64 `json:"unavailable"`
+}
+
+var lookupCounters struct {
+	storeErrors, degraded, failedOpen, unavailable atomic.Int64
+}
+
+func init() {
+	expvar.Publish("promo_lookups", expvar.Func(func() any { return ReadLookupStats() }))
+}
+
+// ReadLookupStats returns the failing-store counters since startup. They
+// are also published through expvar as "promo_lookups".
+func ReadLookupStats() LookupStats {
+	return LookupStats{
+		StoreErrors: lookupCounters.storeErrors.Load(),
+		Degraded:    lookupCounters.degraded.Load(),
+		FailedOpen:  lookupCounters.failedOpen.Load(),
+		Unavailable: lookupCounters.unavailable.Load(),
+	}
+}
@@ -0,0 +1,85 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// corrupt overwrites code's window in store i with bytes that fail to
+// decode, so reading it returns an error.
+func corrupt(t *testing.T, pi *PebbleIndex, i int, code string) {
+	t.Helper()
+	if err := pi.Stores[i].DB.Set([]byte(code), []byte{9}, pebble.Sync); err != nil {
+		t.Fatalf("corrupting %s in store %d: %v", code, i, err)
+	}
+}
+
+func TestPebbleIndex_FailingStores(t *testing.T) {
+	for _, mode := range []LookupMode{LookupSequential, LookupParallel} {
+		for _, failMode := range []FailMode{FailClosed, FailOpen} {
+			t.Run(string(mode)+"/"+string(failMode), func(t *testing.T) {
+				dir := t.TempDir()
+				codes := []string{"INALL0001", "INTWO0001"}
+				paths := []string{
+					writeTxtFile(t, dir, "a.txt", codes),
+					writeTxtFile(t, dir, "b.txt", codes),
+					writeTxtFile(t, dir, "c.txt", []string{"INALL0001"}),
+				}
+				pi, err := NewPebbleIndex(paths, Options{Quorum: 2, Mode: mode, FailMode: failMode})
+				if err != nil {
+					t.Fatalf("NewPebbleIndex error: %v", err)
+				}
+				defer pi.Close()
+				ctx := context.Background()
+
+				// One failing store: the other two still settle both codes.
+				corrupt(t, pi, 0, "INALL0001")
+				corrupt(t, pi, 0, "INTWO0001")
+				before := ReadLookupStats()
+				if status, err := pi.Lookup(ctx, "INALL0001", time.Now()); err != nil || status != StatusActive {
+					t.Errorf("INALL0001 with one failing store = %s, %v; want active", status, err)
+				}
+				// Only one healthy store has INTWO0001, so the failed one
+				// decides.
+				status, err := pi.Lookup(ctx, "INTWO0001", time.Now())
+				if failMode == FailOpen {
+					if err != nil || status != StatusActive {
+						t.Errorf("fail open: INTWO0001 = %s, %v; want active", status, err)
+					}
+				} else if !errors.Is(err, ErrUnavailable) {
+					t.Errorf("fail closed: INTWO0001 = %s, %v; want ErrUnavailable", status, err)
+				}
+				// A code no healthy store has cannot reach the quorum through
+				// one failed store.
+				if status, err := pi.Lookup(ctx, "NOWHERE01", time.Now()); err != nil || status != StatusInvalid {
+					t.Errorf("NOWHERE01 = %s, %v; want invalid", status, err)
+				}
+
+				after := ReadLookupStats()
+				if after.StoreErrors <= before.StoreErrors || after.Degraded <= before.Degraded {
+					t.Errorf("expected store error and degraded counters to grow: %+v -> %+v", before, after)
+				}
+
+				stores, err := pi.MatchingStores(ctx, "INALL0001")
+				if err != nil || len(stores) != 2 {
+					t.Errorf("MatchingStores = %v, %v; want the two healthy stores", stores, err)
+				}
+			})
+		}
+	}
+}
+
+func TestParseFailMode(t *testing.T) {
+	for in, want := range map[string]FailMode{"closed": FailClosed, " OPEN ": FailOpen} {
+		if got, err := ParseFailMode(in); err != nil || got != want {
+			t.Errorf("ParseFailMode(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseFailMode("sometimes"); err == nil {
+		t.Errorf("expected error for unknown fail mode")
+	}
+}
@@ -0,0 +1,153 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// errStoreDegraded is recorded for stores skipped because their last probe
+// failed.
+var errStoreDegraded = errors.New("promo store is degraded")
+
+// StoreHealth is the result of probing one store. Txt and DbDir are base
+// names, so the result does not reveal where the server keeps its files.
+type StoreHealth struct {
+	Txt     string    `json:"txt"`
+	DbDir   string    `json:"dbDir"`
+	Opened  time.Time `json:"opened"`
+	Healthy bool      `json:"healthy"`
+	// Error explains why the probe failed.
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+	// ProbeMicros is how long the sentinel read took.
+	ProbeMicros int64 `json:"probeMicros"`
+	// Codes is the code count recorded when the store was built.
+	Codes     int64  `json:"codes"`
+	DiskBytes uint64 `json:"diskBytes"`
+	// ReadAmp is the number of sstables a read may have to check.
+	ReadAmp int `json:"readAmp"`
+}
+
+// Health summarizes whether an index can answer lookups.
+type Health struct {
+	// Ready is true when enough stores are healthy to reach the quorum.
+	Ready   bool          `json:"ready"`
+	Quorum  int           `json:"quorum"`
+	Healthy int           `json:"healthy"`
+	Stores  []StoreHealth `json:"stores,omitempty"`
+}
+
+// HealthChecker is implemented by indexes that can probe their stores.
+// Indexes without it are usable as soon as they are open.
+type HealthChecker interface {
+	// CheckHealth probes the stores now.
+	CheckHealth() Health
+	// LastHealth returns the latest probe result without probing again
+	// when one is being kept fresh, so serving it is cheap.
+	LastHealth() Health
+}
+
+var _ HealthChecker = (*PebbleIndex)(nil)
+
+// Probe reads the store's metadata key and collects its metrics. A store
+// whose probe fails is marked degraded and skipped by lookups until a later
+// probe succeeds.
+func (s *PebbleStore) Probe() StoreHealth {
+	start := time.Now()
+	h := StoreHealth{
+		Txt:       filepath.Base(s.Txt),
+		DbDir:     filepath.Base(s.DbDir),
+		Opened:    s.Opened,
+		CheckedAt: start.UTC(),
+		Codes:     s.Meta.Codes,
+	}
+	err := errStoreNotOpen
+	if s.DB != nil {
+		_, err = readMeta(s.DB)
+	}
+	h.ProbeMicros = time.Since(start).Microseconds()
+	if err != nil {
+		h.Error = err.Error()
+	} else {
+		h.Healthy = true
+	}
+	if s.DB != nil {
+		m := s.DB.Metrics()
+		h.DiskBytes = m.DiskSpaceUsage()
+		h.ReadAmp = m.ReadAmp()
+	}
+
+	if s.degraded.Swap(!h.Healthy) != !h.Healthy {
+		if h.Healthy {
+			log.Printf("promo store %s recovered", s.DbDir)
+		} else {
+			log.Printf("promo store %s is degraded: %s", s.DbDir, h.Error)
+		}
+	}
+	return h
+}
+
+// Degraded reports whether the store's last probe failed.
+func (s *PebbleStore) Degraded() bool { return s.degraded.Load() }
+
+// CheckHealth probes every store and keeps the result for LastHealth. A
+// closed index is never ready.
+func (pi *PebbleIndex) CheckHealth() Health {
+	pi.mu.RLock()
+	defer pi.mu.RUnlock()
+
+	h := Health{Quorum: pi.Quorum}
+	if pi.closed {
+		return h
+	}
+	for _, s := range pi.Stores {
+		sh := s.Probe()
+		if sh.Healthy {
+			h.Healthy++
+		}
+		h.Stores = append(h.Stores, sh)
+	}
+	h.Ready = h.Healthy >= pi.Quorum
+	pi.lastHealth.Store(&h)
+	return h
+}
+
+// LastHealth returns the result of the latest probe while WatchHealth is
+// running. Without a watcher, or before its first probe, it probes now.
+func (pi *PebbleIndex) LastHealth() Health {
+	pi.mu.RLock()
+	closed := pi.closed
+	pi.mu.RUnlock()
+	if closed {
+		return Health{Quorum: pi.Quorum}
+	}
+	if last := pi.lastHealth.Load(); last != nil && pi.watchingHealth.Load() {
+		return *last
+	}
+	return pi.CheckHealth()
+}
+
+// WatchHealth probes every store each interval until ctx is done, so
+// failing stores are skipped by lookups and recovered ones brought back. It
+// blocks, so run it in its own goroutine.
+func (pi *PebbleIndex) WatchHealth(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	pi.watchingHealth.Store(true)
+	defer pi.watchingHealth.Store(false)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pi.CheckHealth()
+		}
+	}
+}
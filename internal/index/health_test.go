@@ -0,0 +1,105 @@
+package index
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestPebbleIndex_CheckHealth(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{
+		writeTxtFile(t, dir, "a.txt", []string{"INALL0001"}),
+		writeTxtFile(t, dir, "b.txt", []string{"INALL0001"}),
+		writeTxtFile(t, dir, "c.txt", []string{"INALL0001", "INONE0001"}),
+	}
+	pi, err := NewPebbleIndex(paths, Options{Quorum: 2})
+	if err != nil {
+		t.Fatalf("NewPebbleIndex error: %v", err)
+	}
+	defer pi.Close()
+
+	h := pi.CheckHealth()
+	if !h.Ready || h.Healthy != 3 || h.Quorum != 2 || len(h.Stores) != 3 {
+		t.Fatalf("CheckHealth = %+v, want all 3 stores healthy and ready", h)
+	}
+	if s := h.Stores[2]; s.Txt != "c.txt" || s.DbDir != "c.txt.peb" || s.Codes != 2 || s.DiskBytes == 0 || s.Opened.IsZero() || s.CheckedAt.IsZero() {
+		t.Errorf("unexpected store health %+v", s)
+	}
+
+	// A store whose sentinel key cannot be read is degraded and skipped.
+	if err := pi.Stores[0].DB.Set(metaKey, []byte("{"), pebble.Sync); err != nil {
+		t.Fatalf("corrupting metadata: %v", err)
+	}
+	h = pi.CheckHealth()
+	if !h.Ready || h.Healthy != 2 || h.Stores[0].Healthy || h.Stores[0].Error == "" {
+		t.Fatalf("CheckHealth = %+v, want store 0 degraded and the index still ready", h)
+	}
+	if !pi.Stores[0].Degraded() {
+		t.Errorf("expected store 0 to be marked degraded")
+	}
+	before := ReadLookupStats()
+	if status, err := pi.Lookup(context.Background(), "INALL0001", time.Now()); err != nil || status != StatusActive {
+		t.Errorf("Lookup with a degraded store = %s, %v; want active", status, err)
+	}
+	if after := ReadLookupStats(); after.StoreErrors != before.StoreErrors {
+		t.Errorf("expected the degraded store to be skipped, not read: %+v -> %+v", before, after)
+	}
+
+	if err := pi.Stores[1].DB.Set(metaKey, []byte("{"), pebble.Sync); err != nil {
+		t.Fatalf("corrupting metadata: %v", err)
+	}
+	if h := pi.CheckHealth(); h.Ready || h.Healthy != 1 {
+		t.Errorf("CheckHealth = %+v, want not ready with one healthy store", h)
+	}
+
+	// Restoring the metadata brings the store back on the next probe.
+	if err := writeMeta(pi.Stores[0].DB, pi.Stores[0].Meta); err != nil {
+		t.Fatalf("restoring metadata: %v", err)
+	}
+	if h := pi.CheckHealth(); !h.Ready || pi.Stores[0].Degraded() {
+		t.Errorf("CheckHealth = %+v, want store 0 recovered", h)
+	}
+
+	pi.Close()
+	if h := pi.CheckHealth(); h.Ready {
+		t.Errorf("expected a closed index not to be ready")
+	}
+	if h := pi.LastHealth(); h.Ready {
+		t.Errorf("expected LastHealth of a closed index not to be ready")
+	}
+}
+
+func TestPebbleIndex_LastHealth(t *testing.T) {
+	dir := t.TempDir()
+	pi, err := NewPebbleIndex([]string{writeTxtFile(t, dir, "a.txt", []string{"INALL0001"})}, Options{Quorum: 1})
+	if err != nil {
+		t.Fatalf("NewPebbleIndex error: %v", err)
+	}
+	defer pi.Close()
+
+	// Without a watcher every call probes.
+	first := pi.LastHealth()
+	if !first.Ready || len(first.Stores) != 1 {
+		t.Fatalf("LastHealth = %+v, want one healthy store", first)
+	}
+	if again := pi.LastHealth(); !again.Stores[0].CheckedAt.After(first.Stores[0].CheckedAt) {
+		t.Errorf("expected LastHealth to probe again without a watcher")
+	}
+
+	// While watched, the latest probe is served until the next one.
+	pi.watchingHealth.Store(true)
+	probed := pi.CheckHealth()
+	if err := pi.Stores[0].DB.Set(metaKey, []byte("{"), pebble.Sync); err != nil {
+		t.Fatalf("corrupting metadata: %v", err)
+	}
+	if h := pi.LastHealth(); !h.Ready || !h.Stores[0].CheckedAt.Equal(probed.Stores[0].CheckedAt) {
+		t.Errorf("LastHealth = %+v, want the cached probe", h)
+	}
+	pi.CheckHealth()
+	if h := pi.LastHealth(); h.Ready {
+		t.Errorf("LastHealth = %+v, want the failed probe once it ran", h)
+	}
+}
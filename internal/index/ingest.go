@@ -0,0 +1,535 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+type BuildMethod string
+
+const (
+	// BuildIngest sorts codes externally, writes them to SSTables and
+	// ingests those into the store, bypassing the WAL and memtables.
+	BuildIngest BuildMethod = "ingest"
+	// BuildBatch writes codes through batches committed every million rows.
+	BuildBatch BuildMethod = "batch"
+)
+
+func ParseBuildMethod(s string) (BuildMethod, error) {
+	switch method := BuildMethod(strings.ToLower(strings.TrimSpace(s))); method {
+	case BuildIngest, BuildBatch:
+		return method, nil
+	default:
+		return "", fmt.Errorf("unknown promo build method %q", s)
+	}
+}
+
+const (
+	defaultRunSize   = 2_000_000
+	targetTableSize  = 64 << 20
+	progressInterval = 5 * time.Second
+)
+
+// Progress describes how far a build has got. Phase is "read" while the
+// source is scanned, "write" while sorted codes are written out, "ingest"
+// while tables are handed to Pebble and "done" at the end.
+type Progress struct {
+	Source     string
+	Phase      string
+	BytesRead  int64
+	TotalBytes int64
+	Codes      int64
+}
+
+// Percent is the share of the source read so far.
+func (p Progress) Percent() float64 {
+	if p.TotalBytes <= 0 {
+		return 100
+	}
+	return float64(p.BytesRead) * 100 / float64(p.TotalBytes)
+}
+
+type BuildOptions struct {
+	// Method selects how codes are loaded. Empty means BuildIngest.
+	Method BuildMethod
+	// RunSize is how many codes are sorted in memory before a run is
+	// spilled to disk. Zero means 2,000,000.
+	RunSize int
+	// Progress is called as the build advances: at most every few seconds
+	// and on every phase change. Nil logs progress instead.
+	Progress func(Progress)
+	// Policy normalizes codes before they are stored. Stores built with a
+	// different Case or Strip are rebuilt.
+	Policy Policy
+}
+
+func (o BuildOptions) runSize() int {
+	if o.RunSize > 0 {
+		return o.RunSize
+	}
+	return defaultRunSize
+}
+
+// progressReporter throttles progress updates for one build.
+type progressReporter struct {
+	fn    func(Progress)
+	last  time.Time
+	phase string
+}
+
+func newProgressReporter(fn func(Progress)) *progressReporter {
+	if fn == nil {
+		fn = logProgress
+	}
+	return &progressReporter{fn: fn}
+}
+
+func logProgress(p Progress) {
+	log.Printf("building pebble index for %s: %s %.1f%% (%d codes)", p.Source, p.Phase, p.Percent(), p.Codes)
+}
+
+func (r *progressReporter) report(p Progress) {
+	now := time.Now()
+	if p.Phase == r.phase && now.Sub(r.last) < progressInterval {
+		return
+	}
+	r.phase, r.last = p.Phase, now
+	r.fn(p)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ingestTxtIntoPebble loads txtPath into db by sorting its codes in runs of
+// opts.RunSize, merging the runs into SSTables and ingesting those. Scratch
+// files live in a directory next to dbDir that is removed on return.
+// Like the batch path, stats.codes counts every code read, duplicates
+// included.
+func ingestTxtIntoPebble(db *pebble.DB, txtPath, dbDir string, opts BuildOptions, progress *progressReporter) (loadStats, error) {
+	f, err := os.Open(txtPath)
+	if err != nil {
+		return loadStats{}, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return loadStats{}, err
+	}
+
+	scratch, err := os.MkdirTemp(filepath.Dir(dbDir), filepath.Base(dbDir)+".sort-")
+	if err != nil {
+		return loadStats{}, err
+	}
+	defer os.RemoveAll(scratch)
+
+	h := sha256.New()
+	counter := &countingReader{r: f}
+	sc := bufio.NewScanner(io.TeeReader(counter, h))
+	sc.Buffer(make([]byte, 1024), 64*1024)
+
+	p := Progress{Source: txtPath, Phase: "read", TotalBytes: stat.Size()}
+	runSize := opts.runSize()
+	var (
+		stats loadStats
+		run   codeRun
+		runs  []string
+	)
+	for sc.Scan() {
+		stats.lines++
+		ok, err := run.add(sc.Bytes(), opts.Policy)
+		if err != nil {
+			return loadStats{}, fmt.Errorf("%s line %d: %w", txtPath, stats.lines, err)
+		}
+		if !ok {
+			continue
+		}
+		stats.codes++
+		if run.len() >= runSize {
+			path, err := run.spill(scratch, len(runs))
+			if err != nil {
+				return loadStats{}, err
+			}
+			runs = append(runs, path)
+		}
+		if stats.lines%65536 == 0 {
+			p.BytesRead, p.Codes = counter.n, stats.codes
+			progress.report(p)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return loadStats{}, err
+	}
+	stats.sha256 = hex.EncodeToString(h.Sum(nil))
+
+	// A source that fits in one run is written straight from memory.
+	var next func() ([]byte, []byte, bool, error)
+	if len(runs) == 0 {
+		run.sort()
+		i := 0
+		next = func() ([]byte, []byte, bool, error) {
+			if i == run.len() {
+				return nil, nil, false, nil
+			}
+			i++
+			return run.code(i - 1), run.value(i - 1), true, nil
+		}
+	} else {
+		if run.len() > 0 {
+			path, err := run.spill(scratch, len(runs))
+			if err != nil {
+				return loadStats{}, err
+			}
+			runs = append(runs, path)
+		}
+		run = codeRun{}
+		m, err := newRunMerger(runs)
+		if err != nil {
+			return loadStats{}, err
+		}
+		defer m.close()
+		next = m.next
+	}
+
+	p.Phase, p.BytesRead, p.Codes = "write", counter.n, 0
+	progress.report(p)
+	w := &tableWriter{dir: scratch, db: db}
+	defer w.abort()
+	var written int64
+	for {
+		code, value, ok, err := next()
+		if err != nil {
+			return loadStats{}, err
+		}
+		if !ok {
+			break
+		}
+		if err := w.set(code, value); err != nil {
+			return loadStats{}, err
+		}
+		written++
+		if written%65536 == 0 {
+			p.Codes = written
+			progress.report(p)
+		}
+	}
+	tables, err := w.finish()
+	if err != nil {
+		return loadStats{}, err
+	}
+
+	p.Phase, p.Codes = "ingest", written
+	progress.report(p)
+	if len(tables) > 0 {
+		if err := db.Ingest(tables); err != nil {
+			return loadStats{}, fmt.Errorf("ingesting sstables: %w", err)
+		}
+	}
+	return stats, nil
+}
+
+// codeRun holds normalized codes and their encoded windows back to back in
+// one buffer rather than as a string each, so sorting millions of them
+// creates no garbage.
+type codeRun struct {
+	buf  []byte
+	offs []codeSpan
+}
+
+// codeSpan locates a code at buf[start:split] and its value at
+// buf[split:end].
+type codeSpan struct{ start, split, end uint32 }
+
+// add normalizes line like parseSourceLine and appends it, reporting false
+// for blank and reserved lines.
+func (r *codeRun) add(line []byte, policy Policy) (bool, error) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || bytes.HasPrefix(line, []byte(reservedPrefix)) {
+		return false, nil
+	}
+	start := len(r.buf)
+	switch {
+	case bytes.IndexByte(line, ',') >= 0 || !policy.normalizesLikeDefault():
+		// Windowed lines are rare enough to go through the string parser,
+		// as is every line under a non-default normalization.
+		code, w, ok, err := parseSourceLine(string(line), policy)
+		if !ok || err != nil {
+			return false, err
+		}
+		r.buf = append(r.buf, code...)
+		split := len(r.buf)
+		r.buf = append(r.buf, w.encode()...)
+		r.offs = append(r.offs, codeSpan{uint32(start), uint32(split), uint32(len(r.buf))})
+		return true, nil
+	case isASCII(line):
+		r.buf = append(r.buf, line...)
+		upperASCII(r.buf[start:])
+	default:
+		r.buf = append(r.buf, bytes.ToUpper(line)...)
+	}
+	end := uint32(len(r.buf))
+	r.offs = append(r.offs, codeSpan{uint32(start), end, end})
+	return true, nil
+}
+
+func (r *codeRun) len() int { return len(r.offs) }
+
+func (r *codeRun) code(i int) []byte { return r.buf[r.offs[i].start:r.offs[i].split] }
+
+func (r *codeRun) value(i int) []byte { return r.buf[r.offs[i].split:r.offs[i].end] }
+
+// sort orders the codes and drops duplicates, keeping the one read last so
+// a later line overrides an earlier window for the same code.
+func (r *codeRun) sort() {
+	slices.SortStableFunc(r.offs, func(a, b codeSpan) int {
+		return bytes.Compare(r.buf[a.start:a.split], r.buf[b.start:b.split])
+	})
+	out := r.offs[:0]
+	for i, s := range r.offs {
+		if i+1 < len(r.offs) && bytes.Equal(r.code(i), r.code(i+1)) {
+			continue
+		}
+		out = append(out, s)
+	}
+	r.offs = out
+}
+
+// spill sorts the run, writes it to a new file in dir as length-prefixed
+// code and value pairs and empties the run for reuse.
+func (r *codeRun) spill(dir string, n int) (string, error) {
+	r.sort()
+
+	path := filepath.Join(dir, fmt.Sprintf("run-%06d", n))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	bw := bufio.NewWriterSize(f, 1<<20)
+	var hdr []byte
+	for i := range r.offs {
+		code, value := r.code(i), r.value(i)
+		hdr = binary.AppendUvarint(hdr[:0], uint64(len(code)))
+		hdr = binary.AppendUvarint(hdr, uint64(len(value)))
+		bw.Write(hdr)
+		bw.Write(code)
+		bw.Write(value)
+	}
+	err = bw.Flush()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	r.buf, r.offs = r.buf[:0], r.offs[:0]
+	return path, err
+}
+
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func upperASCII(b []byte) {
+	for i, c := range b {
+		if 'a' <= c && c <= 'z' {
+			b[i] = c - 'a' + 'A'
+		}
+	}
+}
+
+// runMerger yields the distinct codes of several sorted runs in order.
+// When runs disagree on a code's value, the latest run wins, matching the
+// order the source was read in.
+type runMerger struct {
+	files []*os.File
+	heap  runHeap
+	last  []byte
+	value []byte
+	began bool
+}
+
+type runHead struct {
+	code, value []byte
+	r           *bufio.Reader
+	run         int
+}
+
+// read loads the next record of the run into h, reporting false at the end
+// of the run.
+func (h *runHead) read() (bool, error) {
+	codeLen, err := binary.ReadUvarint(h.r)
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	valueLen, err := binary.ReadUvarint(h.r)
+	if err != nil {
+		return false, err
+	}
+	h.code = slices.Grow(h.code[:0], int(codeLen))[:codeLen]
+	h.value = slices.Grow(h.value[:0], int(valueLen))[:valueLen]
+	if _, err := io.ReadFull(h.r, h.code); err != nil {
+		return false, err
+	}
+	if _, err := io.ReadFull(h.r, h.value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type runHeap []*runHead
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	if c := bytes.Compare(h[i].code, h[j].code); c != 0 {
+		return c < 0
+	}
+	return h[i].run > h[j].run
+}
+func (h runHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)   { *h = append(*h, x.(*runHead)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func newRunMerger(paths []string) (*runMerger, error) {
+	m := &runMerger{}
+	for i, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			m.close()
+			return nil, err
+		}
+		m.files = append(m.files, f)
+		head := &runHead{r: bufio.NewReaderSize(f, 256<<10), run: i}
+		ok, err := head.read()
+		if err != nil {
+			m.close()
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		if ok {
+			m.heap = append(m.heap, head)
+		}
+	}
+	heap.Init(&m.heap)
+	return m, nil
+}
+
+// next returns the next distinct code and its value. The slices are only
+// valid until the following call.
+func (m *runMerger) next() ([]byte, []byte, bool, error) {
+	for m.heap.Len() > 0 {
+		head := m.heap[0]
+		dup := m.began && bytes.Equal(head.code, m.last)
+		if !dup {
+			m.began = true
+			m.last = append(m.last[:0], head.code...)
+			m.value = append(m.value[:0], head.value...)
+		}
+		ok, err := head.read()
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if ok {
+			heap.Fix(&m.heap, 0)
+		} else {
+			heap.Pop(&m.heap)
+		}
+		if !dup {
+			return m.last, m.value, true, nil
+		}
+	}
+	return nil, nil, false, nil
+}
+
+func (m *runMerger) close() {
+	for _, f := range m.files {
+		f.Close()
+	}
+}
+
+// tableWriter writes sorted keys and their values to SSTables in dir, starting a new table
+// once the current one reaches targetTableSize.
+type tableWriter struct {
+	dir    string
+	db     *pebble.DB
+	w      *sstable.Writer
+	tables []string
+}
+
+func (t *tableWriter) set(key, value []byte) error {
+	if t.w == nil {
+		path := filepath.Join(t.dir, fmt.Sprintf("%06d.sst", len(t.tables)))
+		f, err := vfs.Default.Create(path)
+		if err != nil {
+			return err
+		}
+		opts := pebbleOptions().EnsureDefaults()
+		t.w = sstable.NewWriter(objstorageprovider.NewFileWritable(f),
+			opts.MakeWriterOptions(6, t.db.FormatMajorVersion().MaxTableFormat()))
+		t.tables = append(t.tables, path)
+	}
+	if err := t.w.Set(key, value); err != nil {
+		return err
+	}
+	if t.w.EstimatedSize() >= targetTableSize {
+		return t.closeTable()
+	}
+	return nil
+}
+
+func (t *tableWriter) closeTable() error {
+	w := t.w
+	t.w = nil
+	return w.Close()
+}
+
+// finish closes the open table and returns the paths of all tables written.
+func (t *tableWriter) finish() ([]string, error) {
+	if t.w != nil {
+		if err := t.closeTable(); err != nil {
+			return nil, err
+		}
+	}
+	return t.tables, nil
+}
+
+// abort closes a table left open by a failed build.
+func (t *tableWriter) abort() {
+	if t.w != nil {
+		_ = t.closeTable()
+	}
+}
@@ -0,0 +1,32 @@
+package index
+
+import (
+	"os"
+	"testing"
+)
+
+// BenchmarkBuild compares loading a source through batches with the
+// external sort and SSTable ingestion path. Each iteration builds a store
+// from scratch.
+func BenchmarkBuild(b *testing.B) {
+	n := benchKeys(b)
+	src := writeBenchSources(b, b.TempDir(), n)[0]
+	stat, err := os.Stat(src)
+	if err != nil {
+		b.Fatalf("stat %s: %v", src, err)
+	}
+
+	quiet := func(Progress) {}
+	for _, method := range []BuildMethod{BuildBatch, BuildIngest} {
+		b.Run(string(method), func(b *testing.B) {
+			b.SetBytes(stat.Size())
+			for i := 0; i < b.N; i++ {
+				store, err := RebuildPebble(src, BuildOptions{Method: method, Progress: quiet})
+				if err != nil {
+					b.Fatalf("RebuildPebble error: %v", err)
+				}
+				store.Close()
+			}
+		})
+	}
+}
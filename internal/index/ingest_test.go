@@ -0,0 +1,125 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func storeKeys(t *testing.T, s *PebbleStore) []string {
+	t.Helper()
+	iter, err := s.DB.NewIter(&pebble.IterOptions{LowerBound: []byte{0x01}})
+	if err != nil {
+		t.Fatalf("NewIter error: %v", err)
+	}
+	defer iter.Close()
+
+	var keys []string
+	for iter.First(); iter.Valid(); iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	return keys
+}
+
+func TestParseBuildMethod(t *testing.T) {
+	for in, want := range map[string]BuildMethod{"ingest": BuildIngest, " Batch ": BuildBatch} {
+		got, err := ParseBuildMethod(in)
+		if err != nil || got != want {
+			t.Errorf("ParseBuildMethod(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseBuildMethod("bulk"); err == nil {
+		t.Errorf("expected error for unknown build method")
+	}
+}
+
+func TestIngest_MatchesBatchBuild(t *testing.T) {
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		// Out of order, with duplicates, mixed case and blank lines.
+		lines = append(lines, fmt.Sprintf("code%04d", (i*3)%700), "", " ")
+	}
+
+	for _, runSize := range []int{0, 64} {
+		t.Run(fmt.Sprintf("runSize=%d", runSize), func(t *testing.T) {
+			dir := t.TempDir()
+			batchPath := writeTxtFile(t, dir, "batch.txt", lines)
+			ingestPath := writeTxtFile(t, dir, "ingest.txt", lines)
+
+			batch, err := EnsurePebble(batchPath, BuildOptions{Method: BuildBatch})
+			if err != nil {
+				t.Fatalf("batch build error: %v", err)
+			}
+			defer batch.Close()
+			ingest, err := EnsurePebble(ingestPath, BuildOptions{Method: BuildIngest, RunSize: runSize})
+			if err != nil {
+				t.Fatalf("ingest build error: %v", err)
+			}
+
+			want, got := storeKeys(t, batch), storeKeys(t, ingest)
+			if !slices.Equal(got, want) {
+				t.Fatalf("ingested keys differ from batch keys: got %d keys, want %d", len(got), len(want))
+			}
+			if len(got) != 700 {
+				t.Errorf("got %d keys, want 700 distinct codes", len(got))
+			}
+			if ingest.Meta.SHA256 != batch.Meta.SHA256 || ingest.Meta.Lines != batch.Meta.Lines || ingest.Meta.Codes != batch.Meta.Codes {
+				t.Errorf("ingest meta %+v does not match batch meta %+v", ingest.Meta, batch.Meta)
+			}
+			if ok, _ := ingest.Has("CODE0007"); !ok {
+				t.Errorf("expected CODE0007 to be present")
+			}
+			ingest.Close()
+			if err := VerifyPebble(ingestPath, Policy{}); err != nil {
+				t.Errorf("VerifyPebble error: %v", err)
+			}
+
+			entries, _ := os.ReadDir(dir)
+			for _, e := range entries {
+				if matched, _ := filepath.Match("*.sort-*", e.Name()); matched {
+					t.Errorf("scratch directory %s left behind", e.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestIngest_EmptySource(t *testing.T) {
+	txtPath := writeTxtFile(t, t.TempDir(), "empty.txt", nil)
+
+	store, err := EnsurePebble(txtPath, BuildOptions{})
+	if err != nil {
+		t.Fatalf("EnsurePebble error: %v", err)
+	}
+	defer store.Close()
+
+	if store.Meta.Codes != 0 {
+		t.Errorf("Meta.Codes = %d, want 0", store.Meta.Codes)
+	}
+}
+
+func TestBuild_ReportsProgress(t *testing.T) {
+	txtPath := writeTxtFile(t, t.TempDir(), "codes.txt", []string{"A1", "B2", "C3"})
+
+	var phases []string
+	var last Progress
+	store, err := EnsurePebble(txtPath, BuildOptions{Progress: func(p Progress) {
+		phases = append(phases, p.Phase)
+		last = p
+	}})
+	if err != nil {
+		t.Fatalf("EnsurePebble error: %v", err)
+	}
+	defer store.Close()
+
+	if !slices.Equal(phases, []string{"write", "ingest", "done"}) {
+		t.Errorf("phases = %v, want [write ingest done]", phases)
+	}
+	if last.Codes != 3 || last.Percent() != 100 {
+		t.Errorf("final progress = %+v (%.0f%%), want 3 codes at 100%%", last, last.Percent())
+	}
+}
@@ -0,0 +1,105 @@
+package index
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// OpenPebbleStore opens the existing store for txtPath without building or
+// validating it against the source. Lookups use policy.
+func OpenPebbleStore(txtPath string, policy Policy) (*PebbleStore, error) {
+	dbDir := txtPath + ".peb"
+	if !hasManifest(dbDir) {
+		return nil, fmt.Errorf("no pebble index at %s", dbDir)
+	}
+	return openPebbleStore(txtPath, dbDir, policy)
+}
+
+// VerifyPebble checks that the store for txtPath is complete and still
+// matches its source and policy, returning an error describing the first
+// problem.
+func VerifyPebble(txtPath string, policy Policy) error {
+	store, err := OpenPebbleStore(txtPath, policy)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	reason, err := staleReason(store.Meta, txtPath, policy)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return fmt.Errorf("pebble index for %s is stale: %s", txtPath, reason)
+	}
+
+	// A full scan reads every block, so corrupt tables show up here.
+	keys, err := store.KeyCount()
+	if err != nil {
+		return fmt.Errorf("scanning pebble index for %s: %w", txtPath, err)
+	}
+	if keys > store.Meta.Codes || (keys == 0 && store.Meta.Codes > 0) {
+		return fmt.Errorf("pebble index for %s has %d keys, metadata records %d codes", txtPath, keys, store.Meta.Codes)
+	}
+	return nil
+}
+
+// StoreStats summarizes a store for operators.
+type StoreStats struct {
+	Txt       string `json:"txt"`
+	DbDir     string `json:"dbDir"`
+	Keys      int64  `json:"keys"`
+	DiskBytes int64  `json:"diskBytes"`
+	Meta      Meta   `json:"meta"`
+}
+
+// KeyCount returns the number of promo codes in the store, excluding
+// reserved keys. It scans the whole store.
+func (s *PebbleStore) KeyCount() (int64, error) {
+	if s.DB == nil {
+		return 0, errStoreNotOpen
+	}
+	// Reserved keys start with NUL, so every code sorts at or above 0x01.
+	iter, err := s.DB.NewIter(&pebble.IterOptions{LowerBound: []byte{0x01}})
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close()
+
+	var n int64
+	for iter.First(); iter.Valid(); iter.Next() {
+		n++
+	}
+	return n, iter.Error()
+}
+
+func (s *PebbleStore) Stats() (StoreStats, error) {
+	keys, err := s.KeyCount()
+	if err != nil {
+		return StoreStats{}, err
+	}
+	size, err := dirSize(s.DbDir)
+	if err != nil {
+		return StoreStats{}, err
+	}
+	return StoreStats{Txt: s.Txt, DbDir: s.DbDir, Keys: keys, DiskBytes: size, Meta: s.Meta}, nil
+}
+
+func dirSize(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,81 @@
+package index
+
+import (
+	"os"
+	"testing"
+)
+
+func TestVerifyPebble(t *testing.T) {
+	dir := t.TempDir()
+	txtPath := writeTxtFile(t, dir, "codes.txt", []string{"FIRST123", "SECOND12", "FIRST123"})
+
+	if err := VerifyPebble(txtPath, Policy{}); err == nil {
+		t.Fatalf("expected VerifyPebble to fail before the index is built")
+	}
+
+	store, err := EnsurePebble(txtPath, BuildOptions{})
+	if err != nil {
+		t.Fatalf("EnsurePebble error: %v", err)
+	}
+	store.Close()
+
+	if err := VerifyPebble(txtPath, Policy{}); err != nil {
+		t.Fatalf("VerifyPebble error on a fresh index: %v", err)
+	}
+
+	writeTxtFile(t, dir, "codes.txt", []string{"FIRST123", "SECOND12", "THIRD123"})
+	if err := VerifyPebble(txtPath, Policy{}); err == nil {
+		t.Fatalf("expected VerifyPebble to report a stale index after the source changed")
+	}
+}
+
+func TestPebbleStore_Stats(t *testing.T) {
+	dir := t.TempDir()
+	txtPath := writeTxtFile(t, dir, "codes.txt", []string{"FIRST123", "SECOND12", "FIRST123", ""})
+
+	store, err := EnsurePebble(txtPath, BuildOptions{})
+	if err != nil {
+		t.Fatalf("EnsurePebble error: %v", err)
+	}
+	defer store.Close()
+
+	stats, err := store.Stats()
+	if err != nil {
+		t.Fatalf("Stats error: %v", err)
+	}
+	// duplicates collapse to one key; the metadata key is not counted
+	if stats.Keys != 2 {
+		t.Errorf("Keys = %d, want 2", stats.Keys)
+	}
+	if stats.DiskBytes <= 0 {
+		t.Errorf("DiskBytes = %d, want > 0", stats.DiskBytes)
+	}
+	if stats.Meta.Lines != 4 || stats.Meta.Codes != 3 {
+		t.Errorf("Meta lines/codes = %d/%d, want 4/3", stats.Meta.Lines, stats.Meta.Codes)
+	}
+}
+
+func TestRebuildPebble_ReplacesExistingIndex(t *testing.T) {
+	dir := t.TempDir()
+	txtPath := writeTxtFile(t, dir, "codes.txt", []string{"FIRST123"})
+
+	store, err := EnsurePebble(txtPath, BuildOptions{})
+	if err != nil {
+		t.Fatalf("EnsurePebble error: %v", err)
+	}
+	builtAt := store.Meta.BuiltAt
+	store.Close()
+
+	store, err = RebuildPebble(txtPath, BuildOptions{})
+	if err != nil {
+		t.Fatalf("RebuildPebble error: %v", err)
+	}
+	defer store.Close()
+
+	if !store.Meta.BuiltAt.After(builtAt) {
+		t.Errorf("expected a fresh build, BuiltAt %v is not after %v", store.Meta.BuiltAt, builtAt)
+	}
+	if _, err := os.Stat(txtPath + ".peb"); err != nil {
+		t.Errorf("expected index at %s: %v", txtPath+".peb", err)
+	}
+}
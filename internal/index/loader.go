@@ -0,0 +1,246 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotReady is returned by a Loader's lookups until its index has loaded.
+var ErrNotReady = errors.New("promo index is still loading")
+
+type LoadState string
+
+const (
+	LoadLoading LoadState = "loading"
+	LoadReady   LoadState = "ready"
+	LoadFailed  LoadState = "failed"
+)
+
+// SourceProgress is how far one source has got while loading. Source is
+// the file's base name, so the status does not reveal where it is kept.
+type SourceProgress struct {
+	Source  string  `json:"source"`
+	Phase   string  `json:"phase,omitempty"`
+	Percent float64 `json:"percent"`
+	Codes   int64   `json:"codes"`
+}
+
+// LoadStatus describes a Loader for operators.
+type LoadStatus struct {
+	State LoadState `json:"state"`
+	// Percent is the share of source bytes read so far, across all
+	// sources. Sources that are rebuilt after loading do not lower it.
+	Percent   float64          `json:"percent"`
+	Error     string           `json:"error,omitempty"`
+	StartedAt time.Time        `json:"startedAt"`
+	ReadyAt   time.Time        `json:"readyAt,omitzero"`
+	Sources   []SourceProgress `json:"sources"`
+}
+
+// Loader opens a PromoIndex in the background and stands in for it, so the
+// server can start before a long first build has finished. Until the index
+// is ready, lookups fail with ErrNotReady and health checks report it as
+// not ready.
+type Loader struct {
+	mu      sync.RWMutex
+	idx     PromoIndex
+	err     error
+	closed  bool
+	started time.Time
+	readyAt time.Time
+	sources []Progress
+	done    chan struct{}
+}
+
+var (
+	_ PromoIndex    = (*Loader)(nil)
+	_ StoreMatcher  = (*Loader)(nil)
+	_ HealthChecker = (*Loader)(nil)
+)
+
+// Load starts opening paths with Open in the background. Build progress is
+// recorded for Status and still passed to opts.Build.Progress, or logged
+// when that is nil.
+func Load(backend Backend, paths []string, opts Options) *Loader {
+	l := &Loader{started: time.Now().UTC(), done: make(chan struct{})}
+	for _, path := range paths {
+		p := Progress{Source: strings.TrimSpace(path)}
+		if stat, err := os.Stat(p.Source); err == nil {
+			p.TotalBytes = stat.Size()
+		}
+		l.sources = append(l.sources, p)
+	}
+
+	report := opts.Build.Progress
+	if report == nil {
+		report = logProgress
+	}
+	opts.Build.Progress = func(p Progress) {
+		l.record(p)
+		report(p)
+	}
+	go l.load(backend, paths, opts)
+	return l
+}
+
+func (l *Loader) load(backend Backend, paths []string, opts Options) {
+	idx, err := Open(backend, paths, opts)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer close(l.done)
+	if err != nil {
+		l.err = err
+		return
+	}
+	if l.closed {
+		idx.Close()
+		return
+	}
+	l.idx, l.readyAt = idx, time.Now().UTC()
+	log.Printf("promo index ready after %s", l.readyAt.Sub(l.started).Round(time.Millisecond))
+}
+
+func (l *Loader) record(p Progress) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := range l.sources {
+		if l.sources[i].Source != p.Source {
+			continue
+		}
+		// Rebuilds on reload start over; keep reporting the finished load.
+		if l.idx != nil && l.sources[i].Phase == "done" {
+			return
+		}
+		l.sources[i] = p
+		return
+	}
+}
+
+// Wait blocks until the index has loaded or failed to, or ctx is done.
+func (l *Loader) Wait(ctx context.Context) (PromoIndex, error) {
+	select {
+	case <-l.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.idx, l.err
+}
+
+// Ready reports whether lookups are served by the loaded index.
+func (l *Loader) Ready() bool {
+	_, err := l.current()
+	return err == nil
+}
+
+// Status reports the load state and build progress.
+func (l *Loader) Status() LoadStatus {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	s := LoadStatus{State: LoadLoading, StartedAt: l.started, ReadyAt: l.readyAt}
+	var read, total int64
+	for _, p := range l.sources {
+		read += min(p.BytesRead, p.TotalBytes)
+		total += p.TotalBytes
+		s.Sources = append(s.Sources, SourceProgress{Source: filepath.Base(p.Source), Phase: p.Phase, Percent: p.Percent(), Codes: p.Codes})
+	}
+	if total > 0 {
+		s.Percent = float64(read) * 100 / float64(total)
+	}
+	switch {
+	case l.err != nil:
+		s.State, s.Error = LoadFailed, l.err.Error()
+	case l.idx != nil:
+		s.State, s.Percent = LoadReady, 100
+	}
+	return s
+}
+
+func (l *Loader) current() (PromoIndex, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	switch {
+	case l.closed:
+		return nil, ErrClosed
+	case l.err != nil:
+		return nil, fmt.Errorf("%w: %v", ErrNotReady, l.err)
+	case l.idx == nil:
+		return nil, ErrNotReady
+	}
+	return l.idx, nil
+}
+
+func (l *Loader) IsValid(ctx context.Context, code string) (bool, error) {
+	idx, err := l.current()
+	if err != nil {
+		return false, err
+	}
+	return idx.IsValid(ctx, code)
+}
+
+func (l *Loader) Lookup(ctx context.Context, code string, at time.Time) (Status, error) {
+	idx, err := l.current()
+	if err != nil {
+		return StatusInvalid, err
+	}
+	return idx.Lookup(ctx, code, at)
+}
+
+// MatchingStores asks the loaded index, returning nil when it cannot tell
+// which stores hold a code.
+func (l *Loader) MatchingStores(ctx context.Context, code string) ([]string, error) {
+	idx, err := l.current()
+	if err != nil {
+		return nil, err
+	}
+	if matcher, ok := idx.(StoreMatcher); ok {
+		return matcher.MatchingStores(ctx, code)
+	}
+	return nil, nil
+}
+
+// CheckHealth is not ready until the index has loaded, and then reports
+// the index's own health.
+func (l *Loader) CheckHealth() Health {
+	idx, err := l.current()
+	if err != nil {
+		return Health{}
+	}
+	if checker, ok := idx.(HealthChecker); ok {
+		return checker.CheckHealth()
+	}
+	return Health{Ready: true}
+}
+
+// LastHealth is like CheckHealth, but serves the index's latest probe
+// result.
+func (l *Loader) LastHealth() Health {
+	idx, err := l.current()
+	if err != nil {
+		return Health{}
+	}
+	if checker, ok := idx.(HealthChecker); ok {
+		return checker.LastHealth()
+	}
+	return Health{Ready: true}
+}
+
+// Close closes the index, or makes sure it is closed as soon as it loads.
+func (l *Loader) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	if l.idx != nil {
+		l.idx.Close()
+	}
+}
@@ -0,0 +1,96 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoader_ServesIndexOnceLoaded(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{
+		writeTxtFile(t, dir, "a.txt", []string{"HAPPYHRS"}),
+		writeTxtFile(t, dir, "b.txt", []string{"HAPPYHRS"}),
+	}
+
+	// Hold the first build at its first progress report so the loading
+	// state can be observed.
+	started, release := make(chan Progress), make(chan struct{})
+	var once sync.Once
+	l := Load(BackendPebble, paths, Options{Quorum: 2, Build: BuildOptions{Progress: func(p Progress) {
+		once.Do(func() {
+			started <- p
+			<-release
+		})
+	}}})
+	defer l.Close()
+
+	first := <-started
+	if l.Ready() {
+		t.Errorf("expected loader not to be ready while building")
+	}
+	if _, err := l.Lookup(context.Background(), "HAPPYHRS", time.Now()); !errors.Is(err, ErrNotReady) {
+		t.Errorf("Lookup while loading: err = %v, want ErrNotReady", err)
+	}
+	if h := l.CheckHealth(); h.Ready {
+		t.Errorf("expected CheckHealth not to be ready while loading")
+	}
+	status := l.Status()
+	if status.State != LoadLoading || len(status.Sources) != 2 || status.Percent >= 100 {
+		t.Errorf("Status while loading = %+v", status)
+	}
+	for _, s := range status.Sources {
+		if s.Source == first.Source && s.Phase != first.Phase {
+			t.Errorf("source %s phase = %q, want %q", s.Source, s.Phase, first.Phase)
+		}
+	}
+	close(release)
+
+	if _, err := l.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait error: %v", err)
+	}
+	if !l.Ready() {
+		t.Fatalf("expected loader to be ready")
+	}
+	if status, err := l.Lookup(context.Background(), "HAPPYHRS", time.Now()); err != nil || status != StatusActive {
+		t.Errorf("Lookup = %s, %v; want active", status, err)
+	}
+	if stores, err := l.MatchingStores(context.Background(), "HAPPYHRS"); err != nil || len(stores) != 2 {
+		t.Errorf("MatchingStores = %v, %v", stores, err)
+	}
+	if h := l.CheckHealth(); !h.Ready || h.Healthy != 2 {
+		t.Errorf("CheckHealth = %+v, want ready", h)
+	}
+	status = l.Status()
+	if status.State != LoadReady || status.Percent != 100 || status.ReadyAt.IsZero() {
+		t.Errorf("Status once loaded = %+v", status)
+	}
+	for _, s := range status.Sources {
+		if s.Phase != "done" || s.Codes != 1 {
+			t.Errorf("source progress once loaded = %+v", s)
+		}
+	}
+
+	l.Close()
+	if _, err := l.Lookup(context.Background(), "HAPPYHRS", time.Now()); !errors.Is(err, ErrClosed) {
+		t.Errorf("Lookup after Close: err = %v, want ErrClosed", err)
+	}
+}
+
+func TestLoader_ReportsFailure(t *testing.T) {
+	l := Load(BackendMemory, []string{filepath.Join(t.TempDir(), "missing.txt")}, Options{Quorum: 1})
+	defer l.Close()
+
+	if _, err := l.Wait(context.Background()); err == nil {
+		t.Fatalf("expected Wait to fail for a missing source")
+	}
+	if status := l.Status(); status.State != LoadFailed || status.Error == "" {
+		t.Errorf("Status = %+v, want failed with an error", status)
+	}
+	if _, err := l.Lookup(context.Background(), "HAPPYHRS", time.Now()); !errors.Is(err, ErrNotReady) {
+		t.Errorf("Lookup after a failed load: err = %v, want ErrNotReady", err)
+	}
+}
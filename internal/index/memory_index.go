@@ -0,0 +1,129 @@
+package index
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// MemoryIndex holds every code in memory along with its window in each
+// source that contains it.
+type MemoryIndex struct {
+	Quorum int
+	// Policy normalizes codes and rejects malformed ones on lookup.
+	Policy Policy
+
+	mu      sync.RWMutex
+	windows map[string][]Window
+	closed  bool
+}
+
+// NewMemoryIndex reads every source in paths into memory, with codes
+// normalized by policy.
+func NewMemoryIndex(paths []string, quorum int, policy Policy) (*MemoryIndex, error) {
+	if err := CheckQuorum(paths, quorum); err != nil {
+		return nil, err
+	}
+
+	mi := &MemoryIndex{Quorum: quorum, Policy: policy, windows: make(map[string][]Window)}
+	for _, path := range paths {
+		codes, err := readCodeSet(path, policy)
+		if err != nil {
+			return nil, fmt.Errorf("loading %q: %w", path, err)
+		}
+		for code, w := range codes {
+			mi.windows[code] = append(mi.windows[code], w)
+		}
+	}
+	return mi, nil
+}
+
+// NewMemoryIndexFromCodes returns an index where each of codes is valid,
+// for tests and callers that already have the codes in hand.
+func NewMemoryIndexFromCodes(codes ...string) *MemoryIndex {
+	mi := &MemoryIndex{Quorum: 1, windows: make(map[string][]Window, len(codes))}
+	for _, code := range codes {
+		mi.Add(code, Window{})
+	}
+	return mi
+}
+
+// Add makes code valid within w, replacing any window it had. Meant for
+// indexes built with NewMemoryIndexFromCodes.
+func (mi *MemoryIndex) Add(code string, w Window) {
+	code, ok := mi.Policy.Normalize(code)
+	if !ok {
+		return
+	}
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	if mi.windows == nil {
+		return
+	}
+	mi.windows[code] = []Window{w}
+}
+
+// readCodeSet returns the distinct normalized codes in the file at path
+// with their windows. A code listed twice keeps the later window.
+func readCodeSet(path string, policy Policy) (map[string]Window, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	codes := make(map[string]Window)
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 1024), 64*1024)
+	for line := 1; sc.Scan(); line++ {
+		code, w, ok, err := parseSourceLine(sc.Text(), policy)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if ok {
+			codes[code] = w
+		}
+	}
+	return codes, sc.Err()
+}
+
+// IsValid reports whether code is active now in at least mi.Quorum sources.
+func (mi *MemoryIndex) IsValid(ctx context.Context, code string) (bool, error) {
+	status, err := mi.Lookup(ctx, code, time.Now())
+	return status == StatusActive, err
+}
+
+// Lookup returns the status of code at time at.
+func (mi *MemoryIndex) Lookup(ctx context.Context, code string, at time.Time) (Status, error) {
+	if err := ctx.Err(); err != nil {
+		return StatusInvalid, err
+	}
+	code, ok := mi.Policy.Canonical(code)
+	if !ok {
+		return StatusInvalid, nil
+	}
+
+	mi.mu.RLock()
+	defer mi.mu.RUnlock()
+	if mi.closed {
+		return StatusInvalid, ErrClosed
+	}
+	windows := mi.windows[code]
+	tally := newQuorumTally(mi.Quorum, len(windows), at)
+	for _, w := range windows {
+		if status, done := tally.add(true, w); done {
+			return status, nil
+		}
+	}
+	return StatusInvalid, nil
+}
+
+func (mi *MemoryIndex) Close() {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	mi.closed = true
+	mi.windows = nil
+}
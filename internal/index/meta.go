@@ -0,0 +1,92 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// NormalizationVersion is bumped whenever the way codes are normalized
+// before being stored changes, so existing stores get rebuilt. Version 2
+// stores validity windows as values.
+const NormalizationVersion = 2
+
+// reservedPrefix marks keys that are not promo codes. Normalized codes never
+// start with a NUL byte.
+const reservedPrefix = "\x00"
+
+var metaKey = []byte(reservedPrefix + "meta")
+
+var errNoMeta = errors.New("pebble store has no metadata")
+
+// Meta describes the source file a store was built from. It is written to
+// the store under a reserved key once the bulk load has finished, so a
+// store without it is either from an older build or a build that crashed.
+type Meta struct {
+	Source               string    `json:"source"`
+	Size                 int64     `json:"size"`
+	ModTime              time.Time `json:"modTime"`
+	SHA256               string    `json:"sha256"`
+	Lines                int64     `json:"lines"`
+	Codes                int64     `json:"codes"`
+	BuiltAt              time.Time `json:"builtAt"`
+	NormalizationVersion int       `json:"normalizationVersion"`
+	// Normalization describes the Policy settings that affect stored codes.
+	Normalization string `json:"normalization"`
+}
+
+func readMeta(db *pebble.DB) (Meta, error) {
+	value, closer, err := db.Get(metaKey)
+	if errors.Is(err, pebble.ErrNotFound) {
+		return Meta{}, errNoMeta
+	}
+	if err != nil {
+		return Meta{}, err
+	}
+	defer closer.Close()
+
+	var meta Meta
+	if err := json.Unmarshal(value, &meta); err != nil {
+		return Meta{}, fmt.Errorf("decoding pebble store metadata: %w", err)
+	}
+	return meta, nil
+}
+
+func writeMeta(db *pebble.DB, meta Meta) error {
+	value, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return db.Set(metaKey, value, pebble.Sync)
+}
+
+// staleReason explains why meta no longer describes txtPath, or returns ""
+// when the store is up to date for policy. The checksum is only computed
+// when the cheaper checks pass.
+func staleReason(meta Meta, txtPath string, policy Policy) (string, error) {
+	if meta.NormalizationVersion != NormalizationVersion {
+		return fmt.Sprintf("normalization version %d, want %d", meta.NormalizationVersion, NormalizationVersion), nil
+	}
+	if key := policy.normalizationKey(); meta.Normalization != key {
+		return fmt.Sprintf("normalization %q, want %q", meta.Normalization, key), nil
+	}
+	stat, err := os.Stat(txtPath)
+	if err != nil {
+		return "", err
+	}
+	if stat.Size() != meta.Size {
+		return fmt.Sprintf("source size %d, recorded %d", stat.Size(), meta.Size), nil
+	}
+	sum, err := fileSHA256(txtPath)
+	if err != nil {
+		return "", err
+	}
+	if sum != meta.SHA256 {
+		return "source checksum changed", nil
+	}
+	return "", nil
+}
@@ -1,19 +1,87 @@
 package index
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+var ErrClosed = errors.New("promo index is closed")
+
+type LookupMode string
+
+const (
+	// LookupSequential queries the stores one after another.
+	LookupSequential LookupMode = "sequential"
+	// LookupParallel queries all stores concurrently.
+	LookupParallel LookupMode = "parallel"
+)
+
+func ParseLookupMode(s string) (LookupMode, error) {
+	switch mode := LookupMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case LookupSequential, LookupParallel:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown promo lookup mode %q", s)
+	}
+}
+
+type Options struct {
+	// Quorum is how many stores must contain a code for it to be valid.
+	Quorum int
+	// Mode selects sequential or parallel store lookups. Empty means sequential.
+	Mode LookupMode
+	// Build configures how missing or stale stores are built, both at
+	// startup and on reload.
+	Build BuildOptions
+	// BloomBudget is the memory in bytes shared by per-store Bloom filters
+	// that reject definite misses before Pebble is queried. Zero disables
+	// the pre-check.
+	BloomBudget int64
+	// Policy normalizes codes when stores are built and looked up, and
+	// rejects malformed codes before any store is queried. It overrides
+	// Build.Policy.
+	Policy Policy
+	// FailMode decides lookups that failing stores leave unsettled. Empty
+	// means FailClosed.
+	FailMode FailMode
+}
+
 type PebbleIndex struct {
 	Stores []*PebbleStore
+	Quorum int
+	Mode   LookupMode
+	Policy Policy
+	// FailMode decides lookups that failing stores leave unsettled. Empty
+	// means FailClosed.
+	FailMode FailMode
+
+	// mu is held for reading by every lookup, including parallel lookups that
+	// outlive a short-circuited call, and for writing while a store is
+	// swapped or closed.
+	mu     sync.RWMutex
+	closed bool
+
+	build   BuildOptions
+	bloomFP float64
+
+	// lastHealth is the result of the latest CheckHealth, served by
+	// LastHealth while WatchHealth keeps it fresh.
+	lastHealth     atomic.Pointer[Health]
+	watchingHealth atomic.Bool
 }
 
-func NewPebbleIndex(paths []string) (*PebbleIndex, error) {
-	if len(paths) == 0 {
-		return nil, fmt.Errorf("no pebble paths provided")
+func NewPebbleIndex(paths []string, opts Options) (*PebbleIndex, error) {
+	if err := CheckQuorum(paths, opts.Quorum); err != nil {
+		return nil, err
 	}
+	opts.Build.Policy = opts.Policy
 
 	stores := make([]*PebbleStore, len(paths))
 
@@ -63,7 +131,7 @@ func NewPebbleIndex(paths []string) (*PebbleIndex, error) {
 			sem <- struct{}{}
 			defer func() { <-sem }()
 
-			ps, err := EnsurePebble(path)
+			ps, err := EnsurePebble(path, opts.Build)
 			if err != nil {
 				setErr(fmt.Errorf("ensure pebble for %q: %w", path, err))
 				return
@@ -82,10 +150,21 @@ func NewPebbleIndex(paths []string) (*PebbleIndex, error) {
 		return nil, firstErr
 	}
 
-	return &PebbleIndex{Stores: stores}, nil
+	pi := &PebbleIndex{Stores: stores, Quorum: opts.Quorum, Mode: opts.Mode, Policy: opts.Policy, FailMode: opts.FailMode, build: opts.Build}
+	if opts.BloomBudget > 0 {
+		pi.attachBloomFilters(opts.BloomBudget)
+	}
+	return pi, nil
 }
 
 func (pi *PebbleIndex) Close() {
+	pi.mu.Lock()
+	defer pi.mu.Unlock()
+
+	if pi.closed {
+		return
+	}
+	pi.closed = true
 	for _, s := range pi.Stores {
 		if s != nil {
 			_ = s.Close()
@@ -93,19 +172,208 @@ func (pi *PebbleIndex) Close() {
 	}
 }
 
-func (pi *PebbleIndex) IsValid2of3(code string) (bool, error) {
-	hits := 0
+// IsValid reports whether code is active now in at least pi.Quorum stores.
+func (pi *PebbleIndex) IsValid(ctx context.Context, code string) (bool, error) {
+	return pi.IsValidQuorum(ctx, code, pi.Quorum)
+}
+
+// IsValidQuorum reports whether code is active now in at least k stores.
+func (pi *PebbleIndex) IsValidQuorum(ctx context.Context, code string, k int) (bool, error) {
+	status, err := pi.LookupQuorum(ctx, code, k, time.Now())
+	return status == StatusActive, err
+}
+
+// Lookup returns the status of code at time at, using pi.Quorum.
+func (pi *PebbleIndex) Lookup(ctx context.Context, code string, at time.Time) (Status, error) {
+	return pi.LookupQuorum(ctx, code, pi.Quorum, at)
+}
+
+// LookupQuorum returns the status of code at time at against quorum k, using
+// the index's lookup mode. Both modes stop as soon as the answer is known.
+// A store that fails is skipped and the quorum counted over the others; if
+// they cannot settle the lookup, pi.FailMode decides.
+func (pi *PebbleIndex) LookupQuorum(ctx context.Context, code string, k int, at time.Time) (Status, error) {
+	code, ok := pi.Policy.Canonical(code)
+	if !ok {
+		return StatusInvalid, ctx.Err()
+	}
+	if pi.Mode == LookupParallel {
+		return pi.lookupParallel(ctx, code, k, at)
+	}
+	return pi.lookupSequential(ctx, code, k, at)
+}
+
+func (pi *PebbleIndex) lookupSequential(ctx context.Context, code string, k int, at time.Time) (Status, error) {
+	pi.mu.RLock()
+	defer pi.mu.RUnlock()
+	if pi.closed {
+		return StatusInvalid, ErrClosed
+	}
+
+	tally := newQuorumTally(k, len(pi.Stores), at)
 	for _, s := range pi.Stores {
-		ok, err := s.Has(code)
+		// Not enough stores left to reach k.
+		if tally.impossible() {
+			return StatusInvalid, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return StatusInvalid, err
+		}
+		w, ok, err := lookupStore(s, code)
+		status, done := pi.record(tally, s, ok, w, err)
+		if done {
+			return pi.resolve(code, tally, status)
+		}
+	}
+	return StatusInvalid, nil
+}
+
+// lookupStore reads code from s, failing fast when its last health probe
+// failed.
+func lookupStore(s *PebbleStore, code string) (Window, bool, error) {
+	if s.Degraded() {
+		return Window{}, false, errStoreDegraded
+	}
+	return s.Lookup(code)
+}
+
+// record adds one store's answer, or its failure, to tally.
+func (pi *PebbleIndex) record(tally *quorumTally, s *PebbleStore, ok bool, w Window, err error) (Status, bool) {
+	if errors.Is(err, errStoreDegraded) {
+		return tally.fail(err)
+	}
+	if err != nil {
+		lookupCounters.storeErrors.Add(1)
+		log.Printf("promo store %s failed, continuing with the others: %v", s.DbDir, err)
+		return tally.fail(err)
+	}
+	return tally.add(ok, w)
+}
+
+// resolve applies pi.FailMode to a settled tally whose failed stores could
+// have changed the answer.
+func (pi *PebbleIndex) resolve(code string, tally *quorumTally, status Status) (Status, error) {
+	if tally.failed == 0 {
+		return status, nil
+	}
+	if status == StatusActive || !tally.unsettled() {
+		lookupCounters.degraded.Add(1)
+		return status, nil
+	}
+	if pi.FailMode == FailOpen {
+		lookupCounters.failedOpen.Add(1)
+		log.Printf("accepting promo code %s while %d store(s) are failing", code, tally.failed)
+		return StatusActive, nil
+	}
+	lookupCounters.unavailable.Add(1)
+	return StatusInvalid, fmt.Errorf("%w: %d of %d stores failed: %v", ErrUnavailable, tally.failed, len(pi.Stores), tally.err)
+}
+
+// MatchingStores asks every store for code, without stopping at the quorum.
+// Stores that fail are left out; it only errors when all of them fail.
+func (pi *PebbleIndex) MatchingStores(ctx context.Context, code string) ([]string, error) {
+	code, ok := pi.Policy.Canonical(code)
+	if !ok {
+		return nil, ctx.Err()
+	}
+	pi.mu.RLock()
+	defer pi.mu.RUnlock()
+	if pi.closed {
+		return nil, ErrClosed
+	}
+
+	var (
+		names    []string
+		failed   int
+		firstErr error
+	)
+	for _, s := range pi.Stores {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		_, ok, err := lookupStore(s, code)
+		if errors.Is(err, errStoreDegraded) {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+			continue
+		}
 		if err != nil {
-			return false, err
+			lookupCounters.storeErrors.Add(1)
+			log.Printf("promo store %s failed, continuing with the others: %v", s.DbDir, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+			continue
 		}
 		if ok {
-			hits++
-			if hits >= 2 {
-				return true, nil
+			names = append(names, filepath.Base(s.Txt))
+		}
+	}
+	if failed == len(pi.Stores) {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, firstErr)
+	}
+	return names, nil
+}
+
+type lookupResult struct {
+	store  *PebbleStore
+	ok     bool
+	window Window
+	err    error
+}
+
+func (pi *PebbleIndex) lookupParallel(ctx context.Context, code string, k int, at time.Time) (Status, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pi.mu.RLock()
+	if pi.closed {
+		pi.mu.RUnlock()
+		return StatusInvalid, ErrClosed
+	}
+	var workers sync.WaitGroup
+	// Release the read lock only once every worker is done with its store.
+	defer func() {
+		go func() {
+			workers.Wait()
+			pi.mu.RUnlock()
+		}()
+	}()
+
+	// Buffered so stragglers never block after we return early.
+	results := make(chan lookupResult, len(pi.Stores))
+	for _, s := range pi.Stores {
+		workers.Add(1)
+		go func(s *PebbleStore) {
+			defer workers.Done()
+			if err := ctx.Err(); err != nil {
+				results <- lookupResult{store: s, err: err}
+				return
+			}
+			w, ok, err := lookupStore(s, code)
+			results <- lookupResult{store: s, ok: ok, window: w, err: err}
+		}(s)
+	}
+
+	tally := newQuorumTally(k, len(pi.Stores), at)
+	if tally.impossible() {
+		return StatusInvalid, nil
+	}
+	for range pi.Stores {
+		select {
+		case <-ctx.Done():
+			return StatusInvalid, ctx.Err()
+		case r := <-results:
+			if r.err != nil && ctx.Err() != nil {
+				return StatusInvalid, ctx.Err()
+			}
+			if status, done := pi.record(tally, r.store, r.ok, r.window, r.err); done {
+				return pi.resolve(code, tally, status)
 			}
 		}
 	}
-	return false, nil
+	return StatusInvalid, nil
 }
@@ -0,0 +1,117 @@
+package index
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// benchKeys is the number of codes per store; override with
+// PROMO_BENCH_KEYS for smaller or larger runs.
+func benchKeys(b *testing.B) int {
+	if v := os.Getenv("PROMO_BENCH_KEYS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			b.Fatalf("invalid PROMO_BENCH_KEYS %q: %v", v, err)
+		}
+		return n
+	}
+	return 2_000_000
+}
+
+// writeBenchSources writes three sources where every code C%08d is present
+// in exactly two of them, so quorum-2 lookups hit and 3-of-3 lookups miss.
+func writeBenchSources(b *testing.B, dir string, n int) []string {
+	b.Helper()
+	paths := make([]string, 3)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("couponbase%d", i+1))
+		f, err := os.Create(paths[i])
+		if err != nil {
+			b.Fatalf("create %s: %v", paths[i], err)
+		}
+		w := bufio.NewWriter(f)
+		for c := 0; c < n; c++ {
+			if c%3 == i {
+				continue
+			}
+			fmt.Fprintf(w, "C%08d\n", c)
+		}
+		if err := w.Flush(); err != nil {
+			b.Fatalf("write %s: %v", paths[i], err)
+		}
+		f.Close()
+	}
+	return paths
+}
+
+func BenchmarkPebbleIndex_Lookup(b *testing.B) {
+	n := benchKeys(b)
+	paths := writeBenchSources(b, b.TempDir(), n)
+
+	pi, err := NewPebbleIndex(paths, Options{Quorum: 2})
+	if err != nil {
+		b.Fatalf("NewPebbleIndex error: %v", err)
+	}
+	defer pi.Close()
+
+	ctx := context.Background()
+	cases := []struct {
+		name string
+		code func(i int) string
+		k    int
+	}{
+		{"hit", func(i int) string { return fmt.Sprintf("C%08d", i%n) }, 2},
+		// Sorts between real keys, so a miss still has to search each store.
+		{"miss", func(i int) string { return fmt.Sprintf("C%08dX", i%n) }, 2},
+		{"all-stores", func(i int) string { return fmt.Sprintf("C%08d", i%n) }, 3},
+	}
+
+	for _, mode := range []LookupMode{LookupSequential, LookupParallel} {
+		for _, tc := range cases {
+			b.Run(string(mode)+"/"+tc.name, func(b *testing.B) {
+				pi.Mode = mode
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := pi.IsValidQuorum(ctx, tc.code(i*7919), tc.k); err != nil {
+						b.Fatalf("IsValidQuorum error: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkPebbleIndex_LookupBloom repeats the sequential lookups with the
+// Bloom pre-check enabled (64MB budget) to show how much misses save.
+func BenchmarkPebbleIndex_LookupBloom(b *testing.B) {
+	n := benchKeys(b)
+	paths := writeBenchSources(b, b.TempDir(), n)
+
+	pi, err := NewPebbleIndex(paths, Options{Quorum: 2, BloomBudget: 64 << 20})
+	if err != nil {
+		b.Fatalf("NewPebbleIndex error: %v", err)
+	}
+	defer pi.Close()
+
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name string
+		code func(i int) string
+	}{
+		{"hit", func(i int) string { return fmt.Sprintf("C%08d", i%n) }},
+		{"miss", func(i int) string { return fmt.Sprintf("C%08dX", i%n) }},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := pi.IsValid(ctx, tc.code(i*7919)); err != nil {
+					b.Fatalf("IsValid error: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNewPebbleIndex_RejectsInvalidQuorum(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{
+		writeTxtFile(t, dir, "a.txt", []string{"CODE0001"}),
+		writeTxtFile(t, dir, "b.txt", []string{"CODE0001"}),
+	}
+
+	for _, k := range []int{0, 3} {
+		if _, err := NewPebbleIndex(paths, Options{Quorum: k}); err == nil {
+			t.Errorf("expected error for quorum %d with %d stores", k, len(paths))
+		}
+	}
+}
+
+func TestPebbleIndex_IsValidQuorum(t *testing.T) {
+	for _, mode := range []LookupMode{LookupSequential, LookupParallel} {
+		t.Run(string(mode), func(t *testing.T) {
+			testIsValidQuorum(t, mode)
+		})
+	}
+}
+
+func testIsValidQuorum(t *testing.T, mode LookupMode) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	paths := []string{
+		writeTxtFile(t, dir, "a.txt", []string{"INALL0001", "INTWO0001", "INONE0001"}),
+		writeTxtFile(t, dir, "b.txt", []string{"INALL0001", "INTWO0001"}),
+		writeTxtFile(t, dir, "c.txt", []string{"INALL0001"}),
+	}
+
+	pi, err := NewPebbleIndex(paths, Options{Quorum: 2, Mode: mode})
+	if err != nil {
+		t.Fatalf("NewPebbleIndex error: %v", err)
+	}
+	defer pi.Close()
+
+	tests := []struct {
+		code string
+		k    int
+		want bool
+	}{
+		{"INALL0001", 3, true},
+		{"INTWO0001", 2, true},
+		{"INTWO0001", 3, false},
+		{"INONE0001", 1, true},
+		{"INONE0001", 2, false},
+		{"MISSING01", 1, false},
+	}
+	for _, tt := range tests {
+		got, err := pi.IsValidQuorum(ctx, tt.code, tt.k)
+		if err != nil {
+			t.Fatalf("IsValidQuorum(%q, %d) error: %v", tt.code, tt.k, err)
+		}
+		if got != tt.want {
+			t.Errorf("IsValidQuorum(%q, %d) = %v, want %v", tt.code, tt.k, got, tt.want)
+		}
+	}
+
+	if ok, _ := pi.IsValid(ctx, "INTWO0001"); !ok {
+		t.Errorf("expected IsValid(INTWO0001) = true with quorum 2")
+	}
+	if ok, _ := pi.IsValid(ctx, "INONE0001"); ok {
+		t.Errorf("expected IsValid(INONE0001) = false with quorum 2")
+	}
+
+	stores, err := pi.MatchingStores(ctx, "intwo0001")
+	if err != nil {
+		t.Fatalf("MatchingStores error: %v", err)
+	}
+	if len(stores) != 2 || stores[0] != "a.txt" || stores[1] != "b.txt" {
+		t.Errorf("MatchingStores(intwo0001) = %v, want [a.txt b.txt]", stores)
+	}
+}
+
+func TestPebbleIndex_IsValidHonoursCancelledContext(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{
+		writeTxtFile(t, dir, "a.txt", []string{"CODE0001"}),
+		writeTxtFile(t, dir, "b.txt", []string{"CODE0001"}),
+	}
+
+	for _, mode := range []LookupMode{LookupSequential, LookupParallel} {
+		pi, err := NewPebbleIndex(paths, Options{Quorum: 2, Mode: mode})
+		if err != nil {
+			t.Fatalf("NewPebbleIndex error: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := pi.IsValid(ctx, "CODE0001"); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: IsValid with cancelled context error = %v, want context.Canceled", mode, err)
+		}
+		pi.Close()
+	}
+}
+
+func TestParseLookupMode(t *testing.T) {
+	if mode, err := ParseLookupMode(" Parallel "); err != nil || mode != LookupParallel {
+		t.Fatalf("ParseLookupMode(Parallel) = %q, %v", mode, err)
+	}
+	if _, err := ParseLookupMode("random"); err == nil {
+		t.Fatalf("expected error for unknown lookup mode")
+	}
+}
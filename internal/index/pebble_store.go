@@ -2,75 +2,300 @@ package index
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/cockroachdb/pebble"
+	"github.com/willf/bloom"
 )
 
+// errStoreNotOpen is returned by a store whose DB could not be reopened
+// after a failed reload.
+var errStoreNotOpen = errors.New("promo store is not open")
+
+// PebbleStore is one promo source and its Pebble index. A store with a nil
+// DB stands in for one that could not be reopened: it fails every lookup
+// and probe until the next reload opens it again.
 type PebbleStore struct {
 	DB     *pebble.DB
 	Txt    string
 	DbDir  string
 	Opened time.Time
+	Meta   Meta
+	// Bloom, when set, rejects codes that are definitely not in DB before
+	// a Pebble lookup.
+	Bloom *bloom.BloomFilter
+	// Policy normalizes codes before a lookup. It must match the policy
+	// the store was built with.
+	Policy Policy
+
+	degraded atomic.Bool
+}
+
+func pebbleOptions() *pebble.Options {
+	return &pebble.Options{FormatMajorVersion: pebble.FormatNewest}
 }
 
-func EnsurePebble(txtPath string) (*PebbleStore, error) {
+// OpenPebble opens (creating if needed) a Pebble DB at dir with the same
+// options used for the promo indexes.
+func OpenPebble(dir string) (*pebble.DB, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return pebble.Open(dir, pebbleOptions())
+}
+
+// PrefixUpperBound returns the first key after every key starting with
+// prefix, for use as an exclusive iterator UpperBound. It returns nil, no
+// bound, when prefix is empty or all 0xff.
+func PrefixUpperBound(prefix string) []byte {
+	upper := []byte(prefix)
+	for i := len(upper) - 1; i >= 0; i-- {
+		if upper[i] != 0xff {
+			upper[i]++
+			return upper[:i+1]
+		}
+	}
+	return nil
+}
+
+// EnsurePebble opens the store for txtPath, building it with opts when it is
+// missing or stale. An up-to-date store is reported to opts.Progress as done.
+func EnsurePebble(txtPath string, opts BuildOptions) (*PebbleStore, error) {
 	dbDir := txtPath + ".peb"
-	opts := &pebble.Options{FormatMajorVersion: pebble.FormatNewest}
+	removeTempDirs(dbDir)
 
 	if hasManifest(dbDir) {
-		log.Printf("found pebble indexes for %s", txtPath)
-		db, err := pebble.Open(dbDir, opts)
-		if err != nil {
+		store, err := openPebbleStore(txtPath, dbDir, opts.Policy)
+		if err == nil {
+			reason, err := staleReason(store.Meta, txtPath, opts.Policy)
+			if err != nil {
+				store.Close()
+				return nil, err
+			}
+			if reason == "" {
+				log.Printf("found pebble indexes for %s", txtPath)
+				if opts.Progress != nil {
+					m := store.Meta
+					opts.Progress(Progress{Source: txtPath, Phase: "done", BytesRead: m.Size, TotalBytes: m.Size, Codes: m.Codes})
+				}
+				return store, nil
+			}
+			log.Printf("pebble indexes for %s are stale (%s), rebuilding", txtPath, reason)
+			store.Close()
+		} else if errors.Is(err, errNoMeta) {
+			log.Printf("pebble indexes for %s have no metadata, rebuilding", txtPath)
+		} else {
 			return nil, err
 		}
-		return &PebbleStore{DB: db, Txt: txtPath, DbDir: dbDir, Opened: time.Now()}, nil
 	}
 
+	return RebuildPebble(txtPath, opts)
+}
+
+// RebuildPebble builds a fresh store for txtPath regardless of what is on
+// disk, replacing any existing <txtPath>.peb only once the build succeeded.
+// The store must not be open elsewhere.
+func RebuildPebble(txtPath string, opts BuildOptions) (*PebbleStore, error) {
+	dbDir := txtPath + ".peb"
+
 	log.Printf("Building pebble indexes for %s", txtPath)
-	if err := os.MkdirAll(dbDir, 0o755); err != nil {
+	tmpDir, _, err := buildPebbleTemp(txtPath, dbDir, opts)
+	if err != nil {
 		return nil, err
 	}
+	if err := os.RemoveAll(dbDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, err
+	}
+	if err := os.Rename(tmpDir, dbDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, err
+	}
+
+	return openPebbleStore(txtPath, dbDir, opts.Policy)
+}
+
+const (
+	tempDirSuffix = ".tmp-"
+	// prevDirSuffix names where reload moves the old store while the new
+	// one is swapped in.
+	prevDirSuffix = ".prev"
+)
 
-	db, err := pebble.Open(dbDir, opts)
+// buildPebbleTemp builds txtPath into a new temporary directory next to
+// dbDir and returns its path and metadata. Nothing is left behind if the
+// build fails, so a truncated index can never be picked up as dbDir.
+func buildPebbleTemp(txtPath, dbDir string, opts BuildOptions) (string, Meta, error) {
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dbDir), filepath.Base(dbDir)+tempDirSuffix)
 	if err != nil {
-		return nil, err
+		return "", Meta{}, err
+	}
+	meta, err := buildPebbleDir(txtPath, tmpDir, opts)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return "", Meta{}, fmt.Errorf("building pebble index for %s: %w", txtPath, err)
 	}
+	return tmpDir, meta, nil
+}
 
-	if err := bulkLoadTxtIntoPebble(db, txtPath); err != nil {
-		db.Close()
+// removeTempDirs deletes build directories and the previous store left
+// behind by a process that died mid-build or mid-swap.
+func removeTempDirs(dbDir string) {
+	leftovers, _ := filepath.Glob(dbDir + tempDirSuffix + "*")
+	if _, err := os.Stat(dbDir + prevDirSuffix); err == nil {
+		leftovers = append(leftovers, dbDir+prevDirSuffix)
 	}
+	for _, dir := range leftovers {
+		log.Printf("removing leftover pebble directory %s", dir)
+		_ = os.RemoveAll(dir)
+	}
+}
 
-	if err := db.Flush(); err != nil {
+// openPebbleStore opens an existing store and reads its metadata. A store
+// without metadata is closed and errNoMeta returned.
+func openPebbleStore(txtPath, dbDir string, policy Policy) (*PebbleStore, error) {
+	db, err := pebble.Open(dbDir, pebbleOptions())
+	if err != nil {
+		return nil, err
+	}
+	meta, err := readMeta(db)
+	if err != nil {
 		db.Close()
+		return nil, err
 	}
+	return &PebbleStore{DB: db, Txt: txtPath, DbDir: dbDir, Opened: time.Now(), Meta: meta, Policy: policy}, nil
+}
+
+// buildPebbleDir loads txtPath into a fresh Pebble DB at dbDir and closes
+// it, returning the metadata recorded in the store.
+func buildPebbleDir(txtPath, dbDir string, opts BuildOptions) (Meta, error) {
+	db, err := OpenPebble(dbDir)
+	if err != nil {
+		return Meta{}, err
+	}
+
+	meta, err := loadTxtIntoPebble(db, txtPath, dbDir, opts)
+	if err == nil {
+		err = db.Flush()
+	}
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	return meta, err
+}
+
+// loadTxtIntoPebble bulk-loads txtPath with the method in opts and then
+// records its metadata, so the metadata key is only present once every code
+// has been written.
+func loadTxtIntoPebble(db *pebble.DB, txtPath, dbDir string, opts BuildOptions) (Meta, error) {
+	stat, err := os.Stat(txtPath)
+	if err != nil {
+		return Meta{}, err
+	}
+
+	progress := newProgressReporter(opts.Progress)
+	var stats loadStats
+	switch opts.Method {
+	case BuildIngest, "":
+		stats, err = ingestTxtIntoPebble(db, txtPath, dbDir, opts, progress)
+	case BuildBatch:
+		stats, err = bulkLoadTxtIntoPebble(db, txtPath, opts.Policy, progress)
+	default:
+		err = fmt.Errorf("unknown promo build method %q", opts.Method)
+	}
+	if err != nil {
+		return Meta{}, err
+	}
+
+	meta := Meta{
+		Source:               txtPath,
+		Size:                 stat.Size(),
+		ModTime:              stat.ModTime(),
+		SHA256:               stats.sha256,
+		Lines:                stats.lines,
+		Codes:                stats.codes,
+		BuiltAt:              time.Now().UTC(),
+		NormalizationVersion: NormalizationVersion,
+		Normalization:        opts.Policy.normalizationKey(),
+	}
+	if err := writeMeta(db, meta); err != nil {
+		return Meta{}, err
+	}
+	progress.report(Progress{Source: txtPath, Phase: "done", BytesRead: stat.Size(), TotalBytes: stat.Size(), Codes: stats.codes})
+	return meta, nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
 
-	return &PebbleStore{DB: db, Txt: txtPath, DbDir: dbDir, Opened: time.Now()}, nil
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
+// Has reports whether the store contains code, whatever its window.
 func (s *PebbleStore) Has(code string) (bool, error) {
-	code = strings.ToUpper(strings.TrimSpace(code))
-	if code == "" {
-		return false, nil
+	_, ok, err := s.Lookup(code)
+	return ok, err
+}
+
+// Lookup returns the validity window of code and whether the store contains
+// it.
+func (s *PebbleStore) Lookup(code string) (Window, bool, error) {
+	if s.DB == nil {
+		return Window{}, false, errStoreNotOpen
+	}
+	code, ok := s.Policy.Normalize(code)
+	if !ok {
+		return Window{}, false, nil
 	}
-	_, closer, err := s.DB.Get([]byte(code))
+	if s.Bloom != nil {
+		if !s.Bloom.TestString(code) {
+			bloomCounters.rejected.Add(1)
+			return Window{}, false, nil
+		}
+		bloomCounters.passed.Add(1)
+	}
+	value, closer, err := s.DB.Get([]byte(code))
 	if errors.Is(err, pebble.ErrNotFound) {
-		return false, nil
+		if s.Bloom != nil {
+			bloomCounters.falsePositives.Add(1)
+		}
+		return Window{}, false, nil
 	}
 	if err != nil {
-		return false, err
+		return Window{}, false, err
 	}
-	if closer != nil {
-		_ = closer.Close()
+	w, err := decodeWindow(value)
+	_ = closer.Close()
+	if err != nil {
+		return Window{}, false, fmt.Errorf("%s: code %s: %w", s.DbDir, code, err)
 	}
-	return true, nil
+	return w, true, nil
 }
 
-func (s *PebbleStore) Close() error { return s.DB.Close() }
+func (s *PebbleStore) Close() error {
+	if s.DB == nil {
+		return nil
+	}
+	return s.DB.Close()
+}
 
 func hasManifest(dir string) bool {
 	entries, err := os.ReadDir(dir)
@@ -85,43 +310,66 @@ func hasManifest(dir string) bool {
 	return false
 }
 
-func bulkLoadTxtIntoPebble(db *pebble.DB, txtPath string) error {
+type loadStats struct {
+	sha256 string
+	lines  int64
+	codes  int64
+}
+
+// bulkLoadTxtIntoPebble loads every code in txtPath into db, with its window
+// as the value, and reports the SHA-256 of the bytes it read along with line
+// and code counts. A code listed twice keeps the later window.
+func bulkLoadTxtIntoPebble(db *pebble.DB, txtPath string, policy Policy, progress *progressReporter) (loadStats, error) {
 	f, err := os.Open(txtPath)
 	if err != nil {
-		return err
+		return loadStats{}, err
 	}
 	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return loadStats{}, err
+	}
 
-	sc := bufio.NewScanner(f)
+	h := sha256.New()
+	counter := &countingReader{r: f}
+	sc := bufio.NewScanner(io.TeeReader(counter, h))
 	sc.Buffer(make([]byte, 1024), 64*1024)
 
 	const rowsPerCommit = 1_000_000
 	batch := db.NewBatch()
 	defer batch.Close()
 
-	var n int
+	p := Progress{Source: txtPath, Phase: "read", TotalBytes: stat.Size()}
+	var stats loadStats
 	for sc.Scan() {
-		code := strings.ToUpper(strings.TrimSpace(sc.Text()))
-		if code == "" {
+		stats.lines++
+		code, w, ok, err := parseSourceLine(sc.Text(), policy)
+		if err != nil {
+			return loadStats{}, fmt.Errorf("%s line %d: %w", txtPath, stats.lines, err)
+		}
+		if !ok {
 			continue
 		}
-		if err := batch.Set([]byte(code), nil, pebble.NoSync); err != nil {
-			return err
+		if err := batch.Set([]byte(code), w.encode(), pebble.NoSync); err != nil {
+			return loadStats{}, err
 		}
-		n++
-		if n%rowsPerCommit == 0 {
+		stats.codes++
+		if stats.codes%rowsPerCommit == 0 {
 			if err := batch.Commit(pebble.Sync); err != nil {
-				return err
+				return loadStats{}, err
 			}
 			batch = db.NewBatch()
+			p.BytesRead, p.Codes = counter.n, stats.codes
+			progress.report(p)
 		}
 	}
 	if err := sc.Err(); err != nil {
-		return err
+		return loadStats{}, err
 	}
 	if err := batch.Commit(pebble.Sync); err != nil {
-		return err
+		return loadStats{}, err
 	}
 
-	return nil
+	stats.sha256 = hex.EncodeToString(h.Sum(nil))
+	return stats, nil
 }
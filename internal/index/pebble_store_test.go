@@ -3,6 +3,7 @@ package index
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -28,7 +29,7 @@ func TestEnsurePebble_CreatesAndLoadsFromTxt(t *testing.T) {
 		"",
 	})
 
-	store, err := EnsurePebble(txtPath)
+	store, err := EnsurePebble(txtPath, BuildOptions{})
 	if err != nil {
 		t.Fatalf("EnsurePebble returned error: %v", err)
 	}
@@ -89,7 +90,7 @@ func TestEnsurePebble_ReusesExistingDB(t *testing.T) {
 
 	txtPath := writeTxtFile(t, dir, "codes.txt", []string{"FIRST123"})
 
-	store1, err := EnsurePebble(txtPath)
+	store1, err := EnsurePebble(txtPath, BuildOptions{})
 	if err != nil {
 		t.Fatalf("first EnsurePebble error: %v", err)
 	}
@@ -99,11 +100,10 @@ func TestEnsurePebble_ReusesExistingDB(t *testing.T) {
 	if ok, _ := store1.Has("FIRST123"); !ok {
 		t.Fatalf("expected FIRST123 to exist after first load")
 	}
+	builtAt := store1.Meta.BuiltAt
 	store1.Close()
 
-	txtPath = writeTxtFile(t, dir, "codes.txt", []string{"FIRST123", "NEWCODE99"})
-
-	store2, err := EnsurePebble(txtPath)
+	store2, err := EnsurePebble(txtPath, BuildOptions{})
 	if err != nil {
 		t.Fatalf("second EnsurePebble error: %v", err)
 	}
@@ -112,9 +112,131 @@ func TestEnsurePebble_ReusesExistingDB(t *testing.T) {
 	if ok, _ := store2.Has("FIRST123"); !ok {
 		t.Errorf("expected FIRST123 to still exist in reused DB")
 	}
+	if !store2.Meta.BuiltAt.Equal(builtAt) {
+		t.Errorf("expected DB to be reused for an unchanged source, got BuiltAt %v want %v", store2.Meta.BuiltAt, builtAt)
+	}
+}
+
+func TestEnsurePebble_RebuildsWhenSourceChanges(t *testing.T) {
+	dir := t.TempDir()
+
+	txtPath := writeTxtFile(t, dir, "codes.txt", []string{"FIRST123"})
+
+	store1, err := EnsurePebble(txtPath, BuildOptions{})
+	if err != nil {
+		t.Fatalf("first EnsurePebble error: %v", err)
+	}
+	store1.Close()
+
+	txtPath = writeTxtFile(t, dir, "codes.txt", []string{"FIRST123", "NEWCODE99"})
+
+	store2, err := EnsurePebble(txtPath, BuildOptions{})
+	if err != nil {
+		t.Fatalf("second EnsurePebble error: %v", err)
+	}
+	defer store2.Close()
 
-	if ok, _ := store2.Has("NEWCODE99"); ok {
-		t.Errorf("expected NEWCODE99 to NOT exist; DB should have been reused, not reloaded")
+	if ok, _ := store2.Has("NEWCODE99"); !ok {
+		t.Errorf("expected NEWCODE99 to exist; DB should have been rebuilt from the changed source")
+	}
+	if store2.Meta.Codes != 2 || store2.Meta.Lines != 2 {
+		t.Errorf("Meta codes/lines = %d/%d, want 2/2", store2.Meta.Codes, store2.Meta.Lines)
+	}
+}
+
+func TestEnsurePebble_RebuildsStoreWithoutMetadata(t *testing.T) {
+	dir := t.TempDir()
+	txtPath := writeTxtFile(t, dir, "codes.txt", []string{"FIRST123"})
+
+	// Simulate a build that crashed before the metadata was written.
+	db, err := OpenPebble(txtPath + ".peb")
+	if err != nil {
+		t.Fatalf("OpenPebble error: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+
+	store, err := EnsurePebble(txtPath, BuildOptions{})
+	if err != nil {
+		t.Fatalf("EnsurePebble error: %v", err)
+	}
+	defer store.Close()
+
+	if ok, _ := store.Has("FIRST123"); !ok {
+		t.Errorf("expected FIRST123 to exist after rebuilding a store without metadata")
+	}
+}
+
+func TestEnsurePebble_RecordsMetadata(t *testing.T) {
+	dir := t.TempDir()
+	txtPath := writeTxtFile(t, dir, "codes.txt", []string{"abc123", "", "DEF456"})
+
+	store, err := EnsurePebble(txtPath, BuildOptions{})
+	if err != nil {
+		t.Fatalf("EnsurePebble error: %v", err)
+	}
+	defer store.Close()
+
+	meta, err := readMeta(store.DB)
+	if err != nil {
+		t.Fatalf("readMeta error: %v", err)
+	}
+	sum, _ := fileSHA256(txtPath)
+	if meta.Source != txtPath || meta.SHA256 != sum || meta.Lines != 3 || meta.Codes != 2 {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+	if meta.NormalizationVersion != NormalizationVersion || meta.BuiltAt.IsZero() {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+
+	// the reserved key must never be reported as a promo code
+	if ok, _ := store.Has(string(metaKey)); ok {
+		t.Errorf("expected metadata key not to be a valid code")
+	}
+}
+
+func TestEnsurePebble_FailedBuildIsReportedAndCleanedUp(t *testing.T) {
+	dir := t.TempDir()
+
+	// A line longer than the scanner buffer makes the bulk load fail halfway.
+	txtPath := writeTxtFile(t, dir, "codes.txt", []string{"FIRST123", strings.Repeat("X", 128*1024)})
+
+	store, err := EnsurePebble(txtPath, BuildOptions{})
+	if err == nil {
+		store.Close()
+		t.Fatalf("expected EnsurePebble to report the failed bulk load")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if e.Name() != "codes.txt" {
+			t.Errorf("unexpected leftover entry %s after failed build", e.Name())
+		}
+	}
+
+	if _, err := NewPebbleIndex([]string{txtPath}, Options{Quorum: 1}); err == nil {
+		t.Fatalf("expected NewPebbleIndex to surface the build error")
+	}
+}
+
+func TestEnsurePebble_RemovesUnfinishedBuilds(t *testing.T) {
+	dir := t.TempDir()
+	txtPath := writeTxtFile(t, dir, "codes.txt", []string{"FIRST123"})
+
+	leftover := txtPath + ".peb" + tempDirSuffix + "123"
+	if err := os.MkdirAll(leftover, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	store, err := EnsurePebble(txtPath, BuildOptions{})
+	if err != nil {
+		t.Fatalf("EnsurePebble error: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Errorf("expected unfinished build %s to be removed", leftover)
 	}
 }
 
@@ -134,3 +256,18 @@ func TestHasManifest(t *testing.T) {
 		t.Fatalf("expected hasManifest(%q) = true after manifest file created", dir)
 	}
 }
+
+func TestPrefixUpperBound(t *testing.T) {
+	cases := map[string]string{
+		"order/":    "order0",
+		"a\xff":     "b",
+		"\xff\xff":  "",
+		"":          "",
+		"product/1": "product/2",
+	}
+	for prefix, want := range cases {
+		if got := string(PrefixUpperBound(prefix)); got != want {
+			t.Errorf("PrefixUpperBound(%q) = %q, want %q", prefix, got, want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode/utf8"
+)
+
+type CaseFold string
+
+const (
+	CaseUpper CaseFold = "upper"
+	CaseLower CaseFold = "lower"
+	// CaseNone keeps codes as written, so lookups are case-sensitive.
+	CaseNone CaseFold = "none"
+)
+
+func ParseCaseFold(s string) (CaseFold, error) {
+	switch fold := CaseFold(strings.ToLower(strings.TrimSpace(s))); fold {
+	case CaseUpper, CaseLower, CaseNone:
+		return fold, nil
+	default:
+		return "", fmt.Errorf("unknown promo case folding %q", s)
+	}
+}
+
+var (
+	errCodeLength   = errors.New("promo code has the wrong length")
+	errCodeAlphabet = errors.New("promo code has characters outside the allowed alphabet")
+)
+
+// Policy is how promo codes are normalized and which normalized codes are
+// well formed. The builder only normalizes, so every code in a source is
+// stored; lookups and the request validator also reject codes that are not
+// well formed without touching a store. Changing Case or Strip therefore
+// requires a rebuild, while the format rules can change freely.
+//
+// The zero Policy upper-cases codes and accepts any non-empty code.
+type Policy struct {
+	// Case folds codes after trimming. Empty means CaseUpper.
+	Case CaseFold
+	// Strip lists characters removed anywhere in a code, e.g. "- " so that
+	// "HAPPY-HRS" and "HAPPY HRS" both match HAPPYHRS.
+	Strip string
+	// Alphabet lists the characters a normalized code may contain, with
+	// ranges written as "A-Z0-9". Empty allows any character.
+	Alphabet string
+	// MinLength and MaxLength bound the normalized code in characters.
+	// Zero leaves that side unbounded.
+	MinLength int
+	MaxLength int
+}
+
+// DefaultPolicy matches the original format: upper-cased codes of 8 to 10
+// characters.
+func DefaultPolicy() Policy {
+	return Policy{Case: CaseUpper, MinLength: 8, MaxLength: 10}
+}
+
+// ParsePolicy builds a Policy from configuration strings and checks it.
+func ParsePolicy(caseFold, strip, alphabet string, minLength, maxLength int) (Policy, error) {
+	fold, err := ParseCaseFold(caseFold)
+	if err != nil {
+		return Policy{}, err
+	}
+	p := Policy{Case: fold, Strip: strip, Alphabet: alphabet, MinLength: minLength, MaxLength: maxLength}
+	return p, p.Validate()
+}
+
+// Validate reports configuration mistakes, such as a malformed alphabet.
+func (p Policy) Validate() error {
+	if _, err := ParseCaseFold(string(p.fold())); err != nil {
+		return err
+	}
+	if p.MinLength < 0 || p.MaxLength < 0 {
+		return fmt.Errorf("promo code lengths must not be negative, got %d to %d", p.MinLength, p.MaxLength)
+	}
+	if p.MaxLength > 0 && p.MinLength > p.MaxLength {
+		return fmt.Errorf("promo code min length %d is above max length %d", p.MinLength, p.MaxLength)
+	}
+	if err := validateAlphabet(p.Alphabet); err != nil {
+		return err
+	}
+	if strings.ContainsFunc(p.Strip, func(r rune) bool { return p.Alphabet != "" && inAlphabet(p.Alphabet, r) }) {
+		return fmt.Errorf("promo alphabet %q includes stripped characters %q", p.Alphabet, p.Strip)
+	}
+	return nil
+}
+
+func (p Policy) fold() CaseFold {
+	if p.Case == "" {
+		return CaseUpper
+	}
+	return p.Case
+}
+
+// normalizesLikeDefault reports whether Normalize is plain trimming and
+// upper-casing, which the ingest path handles without allocating.
+func (p Policy) normalizesLikeDefault() bool {
+	return p.fold() == CaseUpper && p.Strip == ""
+}
+
+// Normalize trims code, removes the Strip characters and folds its case.
+// It reports false for codes that end up empty or collide with reserved
+// keys.
+func (p Policy) Normalize(code string) (string, bool) {
+	code = strings.TrimSpace(code)
+	if p.Strip != "" {
+		code = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(p.Strip, r) {
+				return -1
+			}
+			return r
+		}, code)
+	}
+	switch p.fold() {
+	case CaseUpper:
+		code = strings.ToUpper(code)
+	case CaseLower:
+		code = strings.ToLower(code)
+	}
+	if code == "" || strings.HasPrefix(code, reservedPrefix) {
+		return "", false
+	}
+	return code, true
+}
+
+// Check reports whether a normalized code is well formed.
+func (p Policy) Check(code string) error {
+	n := utf8.RuneCountInString(code)
+	if (p.MinLength > 0 && n < p.MinLength) || (p.MaxLength > 0 && n > p.MaxLength) {
+		return errCodeLength
+	}
+	if p.Alphabet != "" && strings.ContainsFunc(code, func(r rune) bool { return !inAlphabet(p.Alphabet, r) }) {
+		return errCodeAlphabet
+	}
+	return nil
+}
+
+// Canonical normalizes code and reports whether the result is well formed.
+// Lookups use it so malformed codes never reach a store.
+func (p Policy) Canonical(code string) (string, bool) {
+	code, ok := p.Normalize(code)
+	if !ok || p.Check(code) != nil {
+		return "", false
+	}
+	return code, true
+}
+
+// normalizationKey identifies how codes are normalized. Stores and Bloom
+// filters record it so that changing Case or Strip triggers a rebuild.
+func (p Policy) normalizationKey() string {
+	return fmt.Sprintf("case=%s strip=%q", p.fold(), p.Strip)
+}
+
+func (p Policy) normalizationHash() uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(p.normalizationKey()))
+	return h.Sum64()
+}
+
+// nextRange reads one character or range from an alphabet such as
+// "A-Z0-9_" and returns the rest. A "-" that does not sit between two
+// characters stands for itself.
+func nextRange(spec string) (lo, hi rune, rest string) {
+	lo, n := utf8.DecodeRuneInString(spec)
+	rest = spec[n:]
+	hi = lo
+	if len(rest) >= 2 && rest[0] == '-' {
+		var m int
+		hi, m = utf8.DecodeRuneInString(rest[1:])
+		rest = rest[1+m:]
+	}
+	return lo, hi, rest
+}
+
+func validateAlphabet(spec string) error {
+	for rest := spec; rest != ""; {
+		var lo, hi rune
+		lo, hi, rest = nextRange(rest)
+		if lo == utf8.RuneError || hi == utf8.RuneError {
+			return fmt.Errorf("invalid promo alphabet %q: not valid UTF-8", spec)
+		}
+		if hi < lo {
+			return fmt.Errorf("invalid promo alphabet %q: range %c-%c is reversed", spec, lo, hi)
+		}
+	}
+	return nil
+}
+
+func inAlphabet(spec string, r rune) bool {
+	for rest := spec; rest != ""; {
+		var lo, hi rune
+		lo, hi, rest = nextRange(rest)
+		if lo <= r && r <= hi {
+			return true
+		}
+	}
+	return false
+}
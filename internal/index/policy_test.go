@@ -0,0 +1,136 @@
+package index
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPolicy_Canonical(t *testing.T) {
+	cases := []struct {
+		policy Policy
+		code   string
+		want   string
+		ok     bool
+	}{
+		{Policy{}, " happyhrs ", "HAPPYHRS", true},
+		{Policy{}, "   ", "", false},
+		{Policy{}, "\x00meta", "", false},
+		{Policy{Case: CaseLower}, "HappyHrs", "happyhrs", true},
+		{Policy{Case: CaseNone}, "HappyHrs", "HappyHrs", true},
+		{Policy{Strip: "- "}, "happy-hrs", "HAPPYHRS", true},
+		{Policy{Strip: "- "}, "HAPPY HRS", "HAPPYHRS", true},
+		{Policy{Strip: "-"}, "---", "", false},
+		{DefaultPolicy(), "HAPPYHRS", "HAPPYHRS", true},
+		{DefaultPolicy(), "SHORT", "", false},
+		{DefaultPolicy(), "MUCHTOOLONG1", "", false},
+		// Lengths count characters, not bytes.
+		{Policy{MaxLength: 8}, "ÉTÉÉTÉÉT", "ÉTÉÉTÉÉT", true},
+		{Policy{Alphabet: "A-Z0-9"}, "HAPPY10", "HAPPY10", true},
+		{Policy{Alphabet: "A-Z0-9"}, "HAPPY_10", "", false},
+		{Policy{Alphabet: "A-Z_-"}, "HAPPY-_", "HAPPY-_", true},
+	}
+	for _, tc := range cases {
+		got, ok := tc.policy.Canonical(tc.code)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("%+v.Canonical(%q) = %q, %v; want %q, %v", tc.policy, tc.code, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy(" Lower ", "-", "a-z0-9", 6, 12)
+	if err != nil {
+		t.Fatalf("ParsePolicy error: %v", err)
+	}
+	if p.Case != CaseLower || p.Strip != "-" || p.Alphabet != "a-z0-9" || p.MinLength != 6 || p.MaxLength != 12 {
+		t.Errorf("ParsePolicy = %+v", p)
+	}
+
+	for _, bad := range []struct {
+		caseFold, strip, alphabet string
+		min, max                  int
+	}{
+		{"title", "", "", 0, 0},
+		{"upper", "", "", -1, 0},
+		{"upper", "", "", 10, 8},
+		{"upper", "", "Z-A", 0, 0},
+		{"upper", "", "\xff", 0, 0},
+		{"upper", "-", "A-Z-", 0, 0},
+	} {
+		if _, err := ParsePolicy(bad.caseFold, bad.strip, bad.alphabet, bad.min, bad.max); err == nil {
+			t.Errorf("ParsePolicy(%q, %q, %q, %d, %d): expected error", bad.caseFold, bad.strip, bad.alphabet, bad.min, bad.max)
+		}
+	}
+}
+
+func TestPolicy_ChangingNormalizationRebuilds(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{writeTxtFile(t, dir, "codes.txt", []string{"happy-hrs", "FIFTY-OFF"})}
+	strip := Policy{Strip: "-", MinLength: 8, MaxLength: 10}
+
+	backends := []struct {
+		name string
+		open func(policy Policy) (PromoIndex, error)
+	}{
+		{"pebble/batch", func(policy Policy) (PromoIndex, error) {
+			return NewPebbleIndex(paths, Options{Quorum: 1, Policy: policy, Build: BuildOptions{Method: BuildBatch}})
+		}},
+		{"pebble/ingest", func(policy Policy) (PromoIndex, error) {
+			return NewPebbleIndex(paths, Options{Quorum: 1, Policy: policy})
+		}},
+		{"bloom", func(policy Policy) (PromoIndex, error) { return NewBloomIndex(paths, 1, policy) }},
+		{"memory", func(policy Policy) (PromoIndex, error) { return NewMemoryIndex(paths, 1, policy) }},
+	}
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			// Build with the default normalization first, so the stored
+			// codes keep their dashes.
+			idx, err := b.open(Policy{})
+			if err != nil {
+				t.Fatalf("open error: %v", err)
+			}
+			if status, _ := idx.Lookup(context.Background(), "HAPPYHRS", time.Now()); status != StatusInvalid {
+				t.Errorf("default policy: HAPPYHRS = %s, want invalid", status)
+			}
+			idx.Close()
+
+			idx, err = b.open(strip)
+			if err != nil {
+				t.Fatalf("open error: %v", err)
+			}
+			defer idx.Close()
+			for code, want := range map[string]Status{
+				"HAPPYHRS":   StatusActive,
+				"happy-hrs":  StatusActive,
+				"fifty-off":  StatusActive,
+				"HAPPY":      StatusInvalid,
+				"HAPPYHRS12": StatusInvalid,
+			} {
+				if got, err := idx.Lookup(context.Background(), code, time.Now()); err != nil || got != want {
+					t.Errorf("Lookup(%q) = %s, %v; want %s", code, got, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyPebble_RejectsOtherNormalization(t *testing.T) {
+	path := writeTxtFile(t, t.TempDir(), "codes.txt", []string{"HAPPYHRS"})
+	store, err := EnsurePebble(path, BuildOptions{})
+	if err != nil {
+		t.Fatalf("EnsurePebble error: %v", err)
+	}
+	store.Close()
+
+	if err := VerifyPebble(path, Policy{}); err != nil {
+		t.Errorf("VerifyPebble with the build policy: %v", err)
+	}
+	// Format rules do not affect what is stored.
+	if err := VerifyPebble(path, DefaultPolicy()); err != nil {
+		t.Errorf("VerifyPebble with other format rules: %v", err)
+	}
+	if err := VerifyPebble(path, Policy{Case: CaseLower}); err == nil {
+		t.Errorf("expected VerifyPebble to reject a store built with another case folding")
+	}
+}
@@ -0,0 +1,104 @@
+package index
+
+import (
+	"expvar"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/willf/bloom"
+)
+
+// Bounds for the false-positive rate derived from the Bloom budget. Below
+// the minimum extra memory buys almost nothing; above the maximum the
+// filter rejects too few codes to be worth checking.
+const (
+	minBloomFalsePositiveRate = 1e-6
+	maxBloomFalsePositiveRate = 0.5
+)
+
+// BloomStats counts outcomes of the Bloom pre-check across all stores.
+type BloomStats struct {
+	// Rejected lookups were answered from memory without touching Pebble.
+	Rejected int64 `json:"rejected"`
+	// Passed lookups may have been present and were checked in Pebble.
+	Passed int64 `json:"passed"`
+	// FalsePositives passed the filter but were not in Pebble.
+	FalsePositives int64 `json:"falsePositives"`
+}
+
+var bloomCounters struct {
+	rejected, passed, falsePositives atomic.Int64
+}
+
+func init() {
+	expvar.Publish("promo_bloom", expvar.Func(func() any { return ReadBloomStats() }))
+}
+
+// ReadBloomStats returns the Bloom pre-check counters since startup. They
+// are also published through expvar as "promo_bloom".
+func ReadBloomStats() BloomStats {
+	return BloomStats{
+		Rejected:       bloomCounters.rejected.Load(),
+		Passed:         bloomCounters.passed.Load(),
+		FalsePositives: bloomCounters.falsePositives.Load(),
+	}
+}
+
+// bloomFalsePositiveRate returns the rate at which filters for codes keys
+// fit in budget bytes, assuming the optimal number of hash functions. It
+// reports false when the budget is too small for a useful filter.
+func bloomFalsePositiveRate(budget, codes int64) (float64, bool) {
+	if codes <= 0 {
+		return minBloomFalsePositiveRate, true
+	}
+	bitsPerCode := float64(budget) * 8 / float64(codes)
+	fp := math.Exp(-bitsPerCode * math.Ln2 * math.Ln2)
+	if fp > maxBloomFalsePositiveRate {
+		return 0, false
+	}
+	return max(fp, minBloomFalsePositiveRate), true
+}
+
+// attachBloomFilters builds or loads a Bloom filter for every store, sized
+// so that together they fit in budget bytes. A store whose filter cannot be
+// built is still used, just without the pre-check.
+func (pi *PebbleIndex) attachBloomFilters(budget int64) {
+	var codes int64
+	for _, s := range pi.Stores {
+		codes += s.Meta.Codes
+	}
+	fp, ok := bloomFalsePositiveRate(budget, codes)
+	if !ok {
+		log.Printf("promo bloom budget of %d bytes is too small for %d codes, pre-check disabled", budget, codes)
+		return
+	}
+	pi.bloomFP = fp
+	log.Printf("promo bloom pre-check: %d codes, false-positive rate %.4g", codes, fp)
+
+	var wg sync.WaitGroup
+	for _, s := range pi.Stores {
+		wg.Add(1)
+		go func(s *PebbleStore) {
+			defer wg.Done()
+			s.Bloom = pi.loadBloom(s.Txt, s.Meta.SHA256, s.Meta.Codes)
+		}(s)
+	}
+	wg.Wait()
+}
+
+// loadBloom returns the pre-check filter for txtPath, whose contents hash to
+// sha, or nil when the pre-check is disabled or the filter could not be
+// built.
+func (pi *PebbleIndex) loadBloom(txtPath, sha string, codes int64) *bloom.BloomFilter {
+	if pi.bloomFP == 0 {
+		return nil
+	}
+	bf, err := buildOrLoadBloomFilter(txtPath, sha, uint(codes), pi.bloomFP, pi.build.Policy)
+	if err != nil {
+		log.Printf("bloom pre-check for %s disabled: %v", txtPath, err)
+		return nil
+	}
+	return bf
+}
@@ -0,0 +1,96 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBloomFalsePositiveRate(t *testing.T) {
+	// 10 bits per code gives roughly 0.8% with optimal hashing.
+	fp, ok := bloomFalsePositiveRate(1_000_000*10/8, 1_000_000)
+	if !ok || fp < 0.007 || fp > 0.009 {
+		t.Errorf("10 bits/code: fp = %v, ok = %v; want ~0.008", fp, ok)
+	}
+	if _, ok := bloomFalsePositiveRate(10, 1_000_000); ok {
+		t.Errorf("expected a tiny budget to disable the pre-check")
+	}
+	if fp, ok := bloomFalsePositiveRate(1<<30, 10); !ok || fp != minBloomFalsePositiveRate {
+		t.Errorf("huge budget: fp = %v, ok = %v; want %v", fp, ok, minBloomFalsePositiveRate)
+	}
+}
+
+func TestPebbleIndex_BloomPreCheck(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	var codes []string
+	for i := 0; i < 1000; i++ {
+		codes = append(codes, fmt.Sprintf("CODE%05d", i))
+	}
+	paths := []string{
+		writeTxtFile(t, dir, "a.txt", codes),
+		writeTxtFile(t, dir, "b.txt", codes),
+	}
+
+	pi, err := NewPebbleIndex(paths, Options{Quorum: 2, BloomBudget: 1 << 20})
+	if err != nil {
+		t.Fatalf("NewPebbleIndex error: %v", err)
+	}
+	defer pi.Close()
+
+	for i, s := range pi.Stores {
+		if s.Bloom == nil {
+			t.Fatalf("store %d has no bloom filter", i)
+		}
+	}
+	if _, err := os.Stat(paths[0] + ".bloom"); err != nil {
+		t.Errorf("expected bloom filter saved next to source: %v", err)
+	}
+
+	before := ReadBloomStats()
+	if ok, err := pi.IsValid(ctx, "CODE00042"); err != nil || !ok {
+		t.Fatalf("IsValid(CODE00042) = %v, %v; want true", ok, err)
+	}
+	for i := 0; i < 100; i++ {
+		if ok, err := pi.IsValid(ctx, fmt.Sprintf("MISS%05d", i)); err != nil || ok {
+			t.Fatalf("IsValid(MISS%05d) = %v, %v; want false", i, ok, err)
+		}
+	}
+	after := ReadBloomStats()
+
+	if got := after.Passed - before.Passed; got < 2 {
+		t.Errorf("passed = %d, want at least 2 for the hit", got)
+	}
+	// At a 1e-6 false-positive rate every miss is rejected by the first store.
+	if got := after.Rejected - before.Rejected; got != 100 {
+		t.Errorf("rejected = %d, want 100", got)
+	}
+}
+
+func TestPebbleIndex_ReloadRebuildsBloom(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := writeTxtFile(t, dir, "codes.txt", []string{"OLDCODE01"})
+
+	pi, err := NewPebbleIndex([]string{path}, Options{Quorum: 1, BloomBudget: 1 << 20})
+	if err != nil {
+		t.Fatalf("NewPebbleIndex error: %v", err)
+	}
+	defer pi.Close()
+
+	writeTxtFile(t, dir, "codes.txt", []string{"OLDCODE01", "NEWCODE01"})
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatalf("Chtimes error: %v", err)
+	}
+	pi.reloadChanged()
+
+	if pi.Stores[0].Bloom == nil {
+		t.Fatalf("reloaded store has no bloom filter")
+	}
+	if ok, err := pi.IsValid(ctx, "NEWCODE01"); err != nil || !ok {
+		t.Errorf("IsValid(NEWCODE01) after reload = %v, %v; want true", ok, err)
+	}
+}
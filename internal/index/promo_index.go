@@ -0,0 +1,86 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PromoIndex answers whether a promo code is valid. Implementations are safe
+// for concurrent use.
+type PromoIndex interface {
+	// IsValid reports whether code is active now.
+	IsValid(ctx context.Context, code string) (bool, error)
+	// Lookup reports whether code is active at time at and, if it is
+	// known but not active, whether its window has closed or not yet
+	// opened.
+	Lookup(ctx context.Context, code string, at time.Time) (Status, error)
+	Close()
+}
+
+// StoreMatcher is implemented by indexes that can tell which of their
+// sources contain a code.
+type StoreMatcher interface {
+	// MatchingStores returns the base names of the sources that contain
+	// code, whatever its window, in PROMO_FILES order.
+	MatchingStores(ctx context.Context, code string) ([]string, error)
+}
+
+var (
+	_ StoreMatcher = (*PebbleIndex)(nil)
+
+	_ PromoIndex = (*PebbleIndex)(nil)
+	_ PromoIndex = (*BloomIndex)(nil)
+	_ PromoIndex = (*MemoryIndex)(nil)
+)
+
+type Backend string
+
+const (
+	// BackendPebble keeps each source in an on-disk Pebble store.
+	BackendPebble Backend = "pebble"
+	// BackendBloom keeps a Bloom filter per source in memory. Lookups can
+	// return false positives.
+	BackendBloom Backend = "bloom"
+	// BackendMemory keeps every code in an in-memory map. Meant for tests
+	// and small sources.
+	BackendMemory Backend = "memory"
+)
+
+func ParseBackend(s string) (Backend, error) {
+	switch backend := Backend(strings.ToLower(strings.TrimSpace(s))); backend {
+	case BackendPebble, BackendBloom, BackendMemory:
+		return backend, nil
+	default:
+		return "", fmt.Errorf("unknown promo backend %q", s)
+	}
+}
+
+// Open builds a PromoIndex over paths using the given backend. Options
+// that do not apply to the backend are ignored.
+func Open(backend Backend, paths []string, opts Options) (PromoIndex, error) {
+	switch backend {
+	case BackendPebble, "":
+		return NewPebbleIndex(paths, opts)
+	case BackendBloom:
+		return NewBloomIndex(paths, opts.Quorum, opts.Policy)
+	case BackendMemory:
+		return NewMemoryIndex(paths, opts.Quorum, opts.Policy)
+	default:
+		return nil, fmt.Errorf("unknown promo backend %q", backend)
+	}
+}
+
+// CheckQuorum reports an error unless quorum is between 1 and the number
+// of paths. Every backend checks it when opening, and the server checks it
+// before loading in the background so bad config fails startup.
+func CheckQuorum(paths []string, quorum int) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no promo paths provided")
+	}
+	if quorum < 1 || quorum > len(paths) {
+		return fmt.Errorf("promo quorum must be between 1 and %d stores, got %d", len(paths), quorum)
+	}
+	return nil
+}
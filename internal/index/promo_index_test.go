@@ -0,0 +1,91 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParseBackend(t *testing.T) {
+	for in, want := range map[string]Backend{"pebble": BackendPebble, " Bloom": BackendBloom, "MEMORY": BackendMemory} {
+		got, err := ParseBackend(in)
+		if err != nil || got != want {
+			t.Errorf("ParseBackend(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseBackend("redis"); err == nil {
+		t.Errorf("expected error for unknown backend")
+	}
+}
+
+func TestOpen_BackendsAgreeOnQuorum(t *testing.T) {
+	ctx := context.Background()
+	for _, backend := range []Backend{BackendPebble, BackendBloom, BackendMemory} {
+		t.Run(string(backend), func(t *testing.T) {
+			dir := t.TempDir()
+			paths := []string{
+				writeTxtFile(t, dir, "a.txt", []string{"INALL0001", "intwo0001", "INONE0001"}),
+				writeTxtFile(t, dir, "b.txt", []string{"INALL0001", " INTWO0001 "}),
+				writeTxtFile(t, dir, "c.txt", []string{"INALL0001"}),
+			}
+
+			idx, err := Open(backend, paths, Options{Quorum: 2})
+			if err != nil {
+				t.Fatalf("Open error: %v", err)
+			}
+
+			for code, want := range map[string]bool{
+				"INALL0001": true,
+				"inTwo0001": true,
+				"INONE0001": false,
+				"MISSING01": false,
+				"":          false,
+			} {
+				got, err := idx.IsValid(ctx, code)
+				if err != nil {
+					t.Fatalf("IsValid(%q) error: %v", code, err)
+				}
+				if got != want {
+					t.Errorf("IsValid(%q) = %v, want %v", code, got, want)
+				}
+			}
+
+			idx.Close()
+			if _, err := idx.IsValid(ctx, "INALL0001"); !errors.Is(err, ErrClosed) {
+				t.Errorf("IsValid after Close error = %v, want ErrClosed", err)
+			}
+		})
+	}
+}
+
+func TestOpen_RejectsInvalidQuorum(t *testing.T) {
+	path := writeTxtFile(t, t.TempDir(), "a.txt", []string{"CODE0001"})
+	for _, backend := range []Backend{BackendPebble, BackendBloom, BackendMemory} {
+		if _, err := Open(backend, []string{path}, Options{Quorum: 2}); err == nil {
+			t.Errorf("%s: expected error for quorum 2 with one source", backend)
+		}
+	}
+}
+
+func TestCheckQuorum(t *testing.T) {
+	paths := []string{"a.txt", "b.txt", "c.txt"}
+	for quorum, wantErr := range map[int]bool{0: true, 1: false, 3: false, 4: true} {
+		if err := CheckQuorum(paths, quorum); (err != nil) != wantErr {
+			t.Errorf("CheckQuorum(3 paths, %d) error = %v, wantErr %v", quorum, err, wantErr)
+		}
+	}
+	if err := CheckQuorum(nil, 1); err == nil {
+		t.Errorf("expected CheckQuorum to reject no paths")
+	}
+}
+
+func TestNewMemoryIndexFromCodes(t *testing.T) {
+	idx := NewMemoryIndexFromCodes("happyhrs", "FIFTYOFF")
+	defer idx.Close()
+
+	for code, want := range map[string]bool{"HAPPYHRS": true, "fiftyoff": true, "OTHER001": false} {
+		if got, _ := idx.IsValid(context.Background(), code); got != want {
+			t.Errorf("IsValid(%q) = %v, want %v", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Watch polls the promo source files every interval and rebuilds any store
+// whose source changed, swapping it into the index while lookups continue.
+// It returns when ctx is cancelled.
+func (pi *PebbleIndex) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pi.reloadChanged()
+		}
+	}
+}
+
+// reloadChanged rebuilds every store whose source no longer matches the
+// fingerprint it was opened with, and retries stores left unopened by a
+// failed reload.
+func (pi *PebbleIndex) reloadChanged() {
+	pi.mu.RLock()
+	stores := append([]*PebbleStore(nil), pi.Stores...)
+	pi.mu.RUnlock()
+
+	for i, s := range stores {
+		if s.DB == nil {
+			log.Printf("promo store %s is not open, rebuilding pebble index", s.DbDir)
+		} else {
+			changed, err := pi.sourceChanged(s)
+			if err != nil {
+				log.Printf("checking promo source %s: %v", s.Txt, err)
+				continue
+			}
+			if !changed {
+				continue
+			}
+			log.Printf("promo source %s changed, rebuilding pebble index", s.Txt)
+		}
+		if err := pi.reload(i); err != nil {
+			log.Printf("reloading promo source %s: %v", s.Txt, err)
+		}
+	}
+}
+
+// sourceChanged compares the store's source file against its metadata.
+// Size and mtime are checked first; the checksum is only computed when they
+// differ, so a touched but unchanged file is not rebuilt. Only the Watch
+// goroutine writes Meta, but it does so under pi.mu so probes and status
+// reads never see a torn value.
+func (pi *PebbleIndex) sourceChanged(s *PebbleStore) (bool, error) {
+	stat, err := os.Stat(s.Txt)
+	if err != nil {
+		return false, err
+	}
+	if stat.Size() == s.Meta.Size && stat.ModTime().Equal(s.Meta.ModTime) {
+		return false, nil
+	}
+	reason, err := staleReason(s.Meta, s.Txt, s.Policy)
+	if err != nil {
+		return false, err
+	}
+	if reason != "" {
+		return true, nil
+	}
+	pi.mu.Lock()
+	s.Meta.ModTime = stat.ModTime()
+	pi.mu.Unlock()
+	return false, nil
+}
+
+// reload rebuilds store i into a temporary directory and swaps it in. The
+// index is write-locked only for the close/rename/open at the end, so
+// lookups wait for the swap rather than failing.
+func (pi *PebbleIndex) reload(i int) error {
+	pi.mu.RLock()
+	old := pi.Stores[i]
+	pi.mu.RUnlock()
+
+	tmpDir, meta, err := buildPebbleTemp(old.Txt, old.DbDir, pi.build)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	bf := pi.loadBloom(old.Txt, meta.SHA256, meta.Codes)
+
+	pi.mu.Lock()
+	defer pi.mu.Unlock()
+	if pi.closed {
+		return ErrClosed
+	}
+
+	// A .prev left by a crash between the renames below would make the
+	// first rename fail on every reload.
+	prevDir := old.DbDir + prevDirSuffix
+	if err := os.RemoveAll(prevDir); err != nil {
+		return err
+	}
+	if err := old.Close(); err != nil {
+		log.Printf("closing pebble store %s: %v", old.DbDir, err)
+	}
+	if err := os.Rename(old.DbDir, prevDir); err != nil {
+		return pi.reopen(i, old, err)
+	}
+	if err := os.Rename(tmpDir, old.DbDir); err != nil {
+		_ = os.Rename(prevDir, old.DbDir)
+		return pi.reopen(i, old, err)
+	}
+
+	fresh, err := openPebbleStore(old.Txt, old.DbDir, pi.build.Policy)
+	if err != nil {
+		_ = os.RemoveAll(old.DbDir)
+		_ = os.Rename(prevDir, old.DbDir)
+		return pi.reopen(i, old, err)
+	}
+	fresh.Bloom = bf
+	pi.Stores[i] = fresh
+	_ = os.RemoveAll(prevDir)
+
+	log.Printf("reloaded pebble index for %s", old.Txt)
+	return nil
+}
+
+// reopen puts the previous store back after a failed swap. The old DB is
+// already closed, so if it cannot be reopened the slot gets a degraded
+// store without a DB: lookups count it as failed rather than reading a
+// closed DB, and the next reloadChanged retries it. Callers hold pi.mu for
+// writing.
+func (pi *PebbleIndex) reopen(i int, old *PebbleStore, cause error) error {
+	restored, err := openPebbleStore(old.Txt, old.DbDir, pi.build.Policy)
+	if err != nil {
+		unopened := &PebbleStore{Txt: old.Txt, DbDir: old.DbDir, Meta: old.Meta, Policy: old.Policy}
+		unopened.degraded.Store(true)
+		pi.Stores[i] = unopened
+		return fmt.Errorf("swap failed (%v) and reopening %s failed: %w", cause, old.DbDir, err)
+	}
+	restored.Bloom = old.Bloom
+	pi.Stores[i] = restored
+	return fmt.Errorf("swapping %s: %w", old.DbDir, cause)
+}
@@ -0,0 +1,179 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPebbleIndex_ReloadsChangedSource(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	txtPath := writeTxtFile(t, dir, "codes.txt", []string{"FIRST123"})
+
+	pi, err := NewPebbleIndex([]string{txtPath}, Options{Quorum: 1})
+	if err != nil {
+		t.Fatalf("NewPebbleIndex error: %v", err)
+	}
+	defer pi.Close()
+
+	// Touching the file without changing it must not trigger a rebuild.
+	opened := pi.Stores[0].Opened
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(txtPath, later, later); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	pi.reloadChanged()
+	if !pi.Stores[0].Opened.Equal(opened) {
+		t.Fatalf("expected store not to be rebuilt for an unchanged source")
+	}
+
+	writeTxtFile(t, dir, "codes.txt", []string{"FIRST123", "NEWCODE99"})
+	later = later.Add(time.Minute)
+	if err := os.Chtimes(txtPath, later, later); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	pi.reloadChanged()
+
+	if ok, err := pi.IsValid(ctx, "NEWCODE99"); err != nil || !ok {
+		t.Fatalf("expected NEWCODE99 to be valid after reload, got %v, %v", ok, err)
+	}
+	if ok, _ := pi.IsValid(ctx, "FIRST123"); !ok {
+		t.Fatalf("expected FIRST123 to stay valid after reload")
+	}
+	if pi.Stores[0].DbDir != txtPath+".peb" {
+		t.Fatalf("expected reloaded store at %s, got %s", txtPath+".peb", pi.Stores[0].DbDir)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if e.Name() != "codes.txt" && e.Name() != "codes.txt.peb" {
+			t.Errorf("unexpected leftover entry %s after reload", e.Name())
+		}
+	}
+}
+
+func TestPebbleIndex_ReloadWhileServing(t *testing.T) {
+	dir := t.TempDir()
+	txtPath := writeTxtFile(t, dir, "codes.txt", []string{"FIRST123"})
+
+	pi, err := NewPebbleIndex([]string{txtPath}, Options{Quorum: 1, Mode: LookupParallel})
+	if err != nil {
+		t.Fatalf("NewPebbleIndex error: %v", err)
+	}
+	defer pi.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ctx.Err() == nil {
+			if ok, err := pi.IsValid(context.Background(), "FIRST123"); err != nil || !ok {
+				t.Errorf("lookup during reload = %v, %v", ok, err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		if err := pi.reload(0); err != nil {
+			t.Fatalf("reload error: %v", err)
+		}
+	}
+	cancel()
+	<-done
+}
+
+func TestPebbleIndex_FailedReopenLeavesFailingStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	txtPath := writeTxtFile(t, dir, "codes.txt", []string{"FIRST123"})
+
+	pi, err := NewPebbleIndex([]string{txtPath}, Options{Quorum: 1, Mode: LookupParallel})
+	if err != nil {
+		t.Fatalf("NewPebbleIndex error: %v", err)
+	}
+	defer pi.Close()
+
+	// Replace the store directory with a file so it cannot be reopened.
+	old := pi.Stores[0]
+	if err := old.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := os.RemoveAll(old.DbDir); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := os.WriteFile(old.DbDir, nil, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	pi.mu.Lock()
+	err = pi.reopen(0, old, errors.New("rename failed"))
+	pi.mu.Unlock()
+	if err == nil {
+		t.Fatalf("expected reopen to fail")
+	}
+
+	if ok, _ := pi.IsValid(ctx, "FIRST123"); ok {
+		t.Fatalf("expected lookups to fail closed while the store is not open")
+	}
+	if h := pi.CheckHealth(); h.Ready || h.Stores[0].Healthy {
+		t.Fatalf("expected the unopened store to be unhealthy, got %+v", h)
+	}
+
+	pi.reloadChanged()
+	if ok, err := pi.IsValid(ctx, "FIRST123"); err != nil || !ok {
+		t.Fatalf("expected FIRST123 to be valid after the store was rebuilt, got %v, %v", ok, err)
+	}
+	if h := pi.CheckHealth(); !h.Ready {
+		t.Fatalf("expected the rebuilt store to be healthy, got %+v", h)
+	}
+}
+
+func TestPebbleIndex_ReloadsOverLeftoverPrevDir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	txtPath := writeTxtFile(t, dir, "codes.txt", []string{"AAAAAAAA"})
+
+	pi, err := NewPebbleIndex([]string{txtPath}, Options{Quorum: 1})
+	if err != nil {
+		t.Fatalf("NewPebbleIndex error: %v", err)
+	}
+
+	// A crash between the two renames of a swap leaves a .prev behind.
+	prevDir := txtPath + ".peb" + prevDirSuffix
+	if err := os.MkdirAll(prevDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(prevDir+"/MANIFEST-000001", nil, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	writeTxtFile(t, dir, "codes.txt", []string{"AAAAAAAA", "BBBBBBBB"})
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(txtPath, later, later); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	pi.reloadChanged()
+	if ok, err := pi.IsValid(ctx, "BBBBBBBB"); err != nil || !ok {
+		t.Fatalf("expected BBBBBBBB to be valid after reload, got %v, %v", ok, err)
+	}
+	if _, err := os.Stat(prevDir); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed after reload, stat error %v", prevDir, err)
+	}
+	pi.Close()
+
+	// Opening the index again clears a leftover .prev as well.
+	if err := os.MkdirAll(prevDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	pi, err = NewPebbleIndex([]string{txtPath}, Options{Quorum: 1})
+	if err != nil {
+		t.Fatalf("NewPebbleIndex error: %v", err)
+	}
+	defer pi.Close()
+	if _, err := os.Stat(prevDir); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed on open, stat error %v", prevDir, err)
+	}
+}
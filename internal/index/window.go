@@ -0,0 +1,199 @@
+package index
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is when a code may be redeemed. A zero StartsAt or EndsAt leaves
+// that side open; EndsAt itself is outside the window.
+type Window struct {
+	StartsAt time.Time `json:"startsAt,omitzero"`
+	EndsAt   time.Time `json:"endsAt,omitzero"`
+}
+
+func (w Window) IsZero() bool { return w.StartsAt.IsZero() && w.EndsAt.IsZero() }
+
+func (w Window) Contains(t time.Time) bool {
+	if !w.StartsAt.IsZero() && t.Before(w.StartsAt) {
+		return false
+	}
+	return w.EndsAt.IsZero() || t.Before(w.EndsAt)
+}
+
+// Windows are stored as the Pebble value of a code: empty for codes that
+// never expire, otherwise a version byte and the start and end as Unix
+// seconds, with 0 for an open side.
+const windowEncodingVersion = 1
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func timeOrZero(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0).UTC()
+}
+
+func (w Window) encode() []byte {
+	if w.IsZero() {
+		return nil
+	}
+	b := []byte{windowEncodingVersion}
+	b = binary.BigEndian.AppendUint64(b, uint64(unixOrZero(w.StartsAt)))
+	return binary.BigEndian.AppendUint64(b, uint64(unixOrZero(w.EndsAt)))
+}
+
+func decodeWindow(b []byte) (Window, error) {
+	if len(b) == 0 {
+		return Window{}, nil
+	}
+	if len(b) != 17 || b[0] != windowEncodingVersion {
+		return Window{}, errors.New("malformed promo window")
+	}
+	return Window{
+		StartsAt: timeOrZero(int64(binary.BigEndian.Uint64(b[1:]))),
+		EndsAt:   timeOrZero(int64(binary.BigEndian.Uint64(b[9:]))),
+	}, nil
+}
+
+// parseSourceLine reads one line of a promo source. A line is either a bare
+// code or "code,starts_at,ends_at" with RFC 3339 times, either of which may
+// be left empty. Codes are normalized with policy, and it reports false for
+// blank and reserved codes.
+func parseSourceLine(line string, policy Policy) (string, Window, bool, error) {
+	raw, times, hasTimes := strings.Cut(line, ",")
+	code, ok := policy.Normalize(raw)
+	if !ok || !hasTimes {
+		return code, Window{}, ok, nil
+	}
+
+	startsAt, endsAt, found := strings.Cut(times, ",")
+	if !found || strings.Contains(endsAt, ",") {
+		return "", Window{}, false, fmt.Errorf("want code,starts_at,ends_at, got %q", line)
+	}
+	var (
+		w   Window
+		err error
+	)
+	if s := strings.TrimSpace(startsAt); s != "" {
+		if w.StartsAt, err = time.Parse(time.RFC3339, s); err != nil {
+			return "", Window{}, false, fmt.Errorf("invalid starts_at: %w", err)
+		}
+	}
+	if s := strings.TrimSpace(endsAt); s != "" {
+		if w.EndsAt, err = time.Parse(time.RFC3339, s); err != nil {
+			return "", Window{}, false, fmt.Errorf("invalid ends_at: %w", err)
+		}
+	}
+	if !w.StartsAt.IsZero() && !w.EndsAt.IsZero() && !w.EndsAt.After(w.StartsAt) {
+		return "", Window{}, false, fmt.Errorf("ends_at %s is not after starts_at %s", endsAt, startsAt)
+	}
+	return code, w, true, nil
+}
+
+// Status is the outcome of looking a code up at a point in time.
+type Status int
+
+const (
+	// StatusInvalid means too few stores contain the code.
+	StatusInvalid Status = iota
+	// StatusActive means enough stores contain the code inside its window.
+	StatusActive
+	// StatusExpired means enough stores contain the code but its window
+	// has closed.
+	StatusExpired
+	// StatusNotYetActive means enough stores contain the code but its
+	// window has not opened.
+	StatusNotYetActive
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusActive:
+		return "active"
+	case StatusExpired:
+		return "expired"
+	case StatusNotYetActive:
+		return "not_yet_active"
+	default:
+		return "invalid"
+	}
+}
+
+// quorumTally combines per-store answers into a Status for quorum k. Stores
+// that fail are counted as failed rather than as lacking the code, so the
+// tally can tell whether the stores that answered settle the lookup.
+type quorumTally struct {
+	k, left         int
+	active, present int
+	failed          int
+	expired         bool
+	at              time.Time
+	err             error
+}
+
+func newQuorumTally(k, stores int, at time.Time) *quorumTally {
+	return &quorumTally{k: k, left: stores, at: at}
+}
+
+// impossible reports whether too few stores are left to reach the quorum,
+// even if every failed store contained the code.
+func (q *quorumTally) impossible() bool {
+	return q.present+q.failed+q.left < q.k
+}
+
+// add records one store's answer and returns the status once it is settled.
+func (q *quorumTally) add(found bool, w Window) (Status, bool) {
+	q.left--
+	if found {
+		q.present++
+		switch {
+		case w.Contains(q.at):
+			q.active++
+		case !w.EndsAt.IsZero() && !q.at.Before(w.EndsAt):
+			q.expired = true
+		}
+	}
+	return q.settle()
+}
+
+// fail records a store that could not answer and returns the status once
+// the remaining stores settle it.
+func (q *quorumTally) fail(err error) (Status, bool) {
+	q.left--
+	q.failed++
+	if q.err == nil {
+		q.err = err
+	}
+	return q.settle()
+}
+
+// unsettled reports whether the failed stores could have made a code that
+// is not active reach the quorum.
+func (q *quorumTally) unsettled() bool {
+	return q.failed > 0 && q.active+q.failed >= q.k
+}
+
+func (q *quorumTally) settle() (Status, bool) {
+	switch {
+	case q.active >= q.k:
+		return StatusActive, true
+	case q.impossible():
+		return StatusInvalid, true
+	case q.left > 0:
+		return StatusInvalid, false
+	case q.expired:
+		return StatusExpired, true
+	default:
+		return StatusNotYetActive, true
+	}
+}
@@ -0,0 +1,163 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSourceLine(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		line   string
+		code   string
+		window Window
+		ok     bool
+	}{
+		{line: " happyhrs ", code: "HAPPYHRS", ok: true},
+		{line: "", ok: false},
+		{line: "happyhrs,2026-01-01T00:00:00Z,2026-02-01T00:00:00Z", code: "HAPPYHRS", window: Window{start, end}, ok: true},
+		{line: "happyhrs,2026-01-01T00:00:00Z,", code: "HAPPYHRS", window: Window{StartsAt: start}, ok: true},
+		{line: "happyhrs, ,2026-02-01T00:00:00Z", code: "HAPPYHRS", window: Window{EndsAt: end}, ok: true},
+		{line: "happyhrs,,", code: "HAPPYHRS", ok: true},
+	}
+	for _, tc := range cases {
+		code, w, ok, err := parseSourceLine(tc.line, Policy{})
+		if err != nil {
+			t.Errorf("parseSourceLine(%q) error: %v", tc.line, err)
+			continue
+		}
+		if code != tc.code || ok != tc.ok || !w.StartsAt.Equal(tc.window.StartsAt) || !w.EndsAt.Equal(tc.window.EndsAt) {
+			t.Errorf("parseSourceLine(%q) = %q, %+v, %v; want %q, %+v, %v", tc.line, code, w, ok, tc.code, tc.window, tc.ok)
+		}
+	}
+
+	for _, line := range []string{
+		"happyhrs,2026-01-01",
+		"happyhrs,2026-01-01,2026-02-01",
+		"happyhrs,2026-02-01T00:00:00Z,2026-01-01T00:00:00Z",
+		"happyhrs,,,",
+	} {
+		if _, _, _, err := parseSourceLine(line, Policy{}); err == nil {
+			t.Errorf("parseSourceLine(%q): expected error", line)
+		}
+	}
+}
+
+func TestWindow_EncodeRoundTrip(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, w := range []Window{{}, {StartsAt: start}, {EndsAt: start}, {start, start.Add(time.Hour)}} {
+		got, err := decodeWindow(w.encode())
+		if err != nil {
+			t.Fatalf("decodeWindow error: %v", err)
+		}
+		if !got.StartsAt.Equal(w.StartsAt) || !got.EndsAt.Equal(w.EndsAt) {
+			t.Errorf("round trip of %+v = %+v", w, got)
+		}
+	}
+	if _, err := decodeWindow([]byte{9}); err == nil {
+		t.Errorf("expected error for malformed window")
+	}
+}
+
+// writeWindowSources writes two sources with windowed codes around now.
+// ENDSSOON is open in the first source but closed in the second, and
+// LASTWINS is expired on its first line and reopened on a later one.
+func writeWindowSources(t *testing.T, dir string, now time.Time) []string {
+	t.Helper()
+	past, future := now.Add(-time.Hour).Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339)
+	longAgo := now.Add(-48 * time.Hour).Format(time.RFC3339)
+
+	var filler []string
+	for i := 0; i < 200; i++ {
+		filler = append(filler, fmt.Sprintf("FILL%04d", i))
+	}
+	first := append([]string{
+		"ALWAYS01",
+		"expired1," + longAgo + "," + past,
+		"upcoming," + future + ",",
+		"ENDSSOON,," + future,
+		"LASTWINS," + longAgo + "," + past,
+	}, filler...)
+	first = append(first, "LASTWINS,"+past+",")
+	second := append([]string{
+		"ALWAYS01",
+		"expired1,," + past,
+		"upcoming," + future + ",",
+		"ENDSSOON,," + past,
+		"LASTWINS,,",
+	}, filler...)
+	return []string{
+		writeTxtFile(t, dir, "windows1.txt", first),
+		writeTxtFile(t, dir, "windows2.txt", second),
+	}
+}
+
+func TestPromoIndex_LookupHonoursWindows(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	want2 := map[string]Status{
+		"ALWAYS01": StatusActive,
+		"expired1": StatusExpired,
+		"UPCOMING": StatusNotYetActive,
+		"ENDSSOON": StatusExpired,
+		"LASTWINS": StatusActive,
+		"UNKNOWN1": StatusInvalid,
+	}
+	want1 := map[string]Status{"ENDSSOON": StatusActive}
+
+	backends := []struct {
+		name string
+		open func(paths []string, quorum int) (PromoIndex, error)
+	}{
+		{"memory", func(paths []string, quorum int) (PromoIndex, error) { return NewMemoryIndex(paths, quorum, Policy{}) }},
+		{"pebble/batch", func(paths []string, quorum int) (PromoIndex, error) {
+			return NewPebbleIndex(paths, Options{Quorum: quorum, Build: BuildOptions{Method: BuildBatch}})
+		}},
+		{"pebble/ingest", func(paths []string, quorum int) (PromoIndex, error) {
+			return NewPebbleIndex(paths, Options{Quorum: quorum, Build: BuildOptions{RunSize: 16}})
+		}},
+		{"pebble/parallel", func(paths []string, quorum int) (PromoIndex, error) {
+			return NewPebbleIndex(paths, Options{Quorum: quorum, Mode: LookupParallel})
+		}},
+	}
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			paths := writeWindowSources(t, t.TempDir(), now)
+			for quorum, want := range map[int]map[string]Status{2: want2, 1: want1} {
+				idx, err := b.open(paths, quorum)
+				if err != nil {
+					t.Fatalf("open error: %v", err)
+				}
+				for code, status := range want {
+					got, err := idx.Lookup(context.Background(), code, now)
+					if err != nil {
+						t.Fatalf("Lookup(%q) error: %v", code, err)
+					}
+					if got != status {
+						t.Errorf("quorum %d: Lookup(%q) = %s, want %s", quorum, code, got, status)
+					}
+				}
+				if ok, _ := idx.IsValid(context.Background(), "EXPIRED1"); ok {
+					t.Errorf("quorum %d: expected EXPIRED1 not to be valid", quorum)
+				}
+				idx.Close()
+			}
+		})
+	}
+}
+
+func TestEnsurePebble_RejectsMalformedWindow(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTxtFile(t, dir, "bad.txt", []string{"HAPPYHRS", "BADCODE1,yesterday,"})
+
+	for _, method := range []BuildMethod{BuildBatch, BuildIngest} {
+		_, err := EnsurePebble(path, BuildOptions{Method: method})
+		if err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("%s: expected error naming line 2, got %v", method, err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package promo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/PerumallaGiridhar/oolio/internal/index"
+)
+
+var (
+	ErrCouponInvalid   = errors.New("invalid coupon")
+	ErrCouponExpired   = errors.New("coupon expired")
+	ErrCouponNotActive = errors.New("coupon not yet active")
+)
+
+// CheckCoupon returns nil if code is active in idx at time at, and
+// otherwise ErrCouponInvalid, ErrCouponExpired or ErrCouponNotActive.
+func CheckCoupon(ctx context.Context, idx index.PromoIndex, code string, at time.Time) error {
+	status, err := idx.Lookup(ctx, code, at)
+	if err != nil {
+		return err
+	}
+	return StatusError(status)
+}
+
+// StatusError maps a lookup status to the error CheckCoupon returns for it.
+func StatusError(status index.Status) error {
+	switch status {
+	case index.StatusActive:
+		return nil
+	case index.StatusExpired:
+		return ErrCouponExpired
+	case index.StatusNotYetActive:
+		return ErrCouponNotActive
+	default:
+		return ErrCouponInvalid
+	}
+}
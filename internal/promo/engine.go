@@ -0,0 +1,94 @@
+package promo
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/PerumallaGiridhar/oolio/internal/index"
+)
+
+// Engine holds the active promo rules and can reload them from disk when
+// the rules file changes.
+type Engine struct {
+	path    string
+	policy  index.Policy
+	rules   atomic.Pointer[[]Rule]
+	modTime time.Time
+}
+
+// NewEngine loads rules from path, normalizing rule and request codes with
+// policy. An empty path yields an engine with no rules, so valid coupons
+// are accepted but give no discount.
+func NewEngine(path string, policy index.Policy) (*Engine, error) {
+	e := &Engine{path: path, policy: policy}
+	e.rules.Store(&[]Rule{})
+	if path == "" {
+		return e, nil
+	}
+	if err := e.reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Engine) reload() error {
+	stat, err := os.Stat(e.path)
+	if err != nil {
+		return err
+	}
+	rules, err := LoadRules(e.path, e.policy)
+	if err != nil {
+		return err
+	}
+	e.rules.Store(&rules)
+	e.modTime = stat.ModTime()
+	log.Printf("loaded %d promo rules from %s", len(rules), e.path)
+	return nil
+}
+
+// Match returns the first rule in file order that matches code.
+func (e *Engine) Match(code string) (Rule, bool) {
+	code, ok := e.policy.Normalize(code)
+	if !ok {
+		return Rule{}, false
+	}
+	for _, r := range *e.rules.Load() {
+		if r.matches(code) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Watch polls the rules file every interval and reloads it when its
+// modification time changes. A file that fails to parse is logged and the
+// previous rules stay active.
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	if e.path == "" || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stat, err := os.Stat(e.path)
+			if err != nil {
+				log.Printf("checking promo rules %s: %v", e.path, err)
+				continue
+			}
+			if stat.ModTime().Equal(e.modTime) {
+				continue
+			}
+			if err := e.reload(); err != nil {
+				log.Printf("reloading promo rules %s: %v", e.path, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package promo
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PerumallaGiridhar/oolio/internal/index"
+	"github.com/cockroachdb/pebble"
+)
+
+var (
+	ErrUsageLimitReached = errors.New("coupon usage limit reached")
+	ErrCustomerRequired  = errors.New("coupon requires a customer id")
+	// ErrKeySeparator rejects codes and customer IDs that contain the "/"
+	// the ledger joins them with, so one cannot read as another's key.
+	ErrKeySeparator = errors.New("coupon code and customer id must not contain '/'")
+)
+
+// Limits caps how often a single code can be redeemed. Zero means no limit.
+type Limits struct {
+	MaxUses            int
+	MaxUsesPerCustomer int
+}
+
+// Redemption records that an order consumed a code.
+type Redemption struct {
+	Code       string    `json:"code"`
+	OrderID    string    `json:"orderId"`
+	CustomerID string    `json:"customerId,omitempty"`
+	RedeemedAt time.Time `json:"redeemedAt"`
+}
+
+// Ledger persists redemptions in Pebble next to the orders. Each
+// redemption is stored under "redemption/<code>/<order>" and counted under
+// "redemption-uses/<code>" and "redemption-customer/<code>/<customer>".
+// Redeem and Release are serialized, so concurrent orders cannot both take
+// the last use of a code.
+type Ledger struct {
+	db     *pebble.DB
+	policy index.Policy
+	mu     sync.Mutex
+}
+
+const (
+	redemptionKeyPrefix = "redemption/"
+	usesKeyPrefix       = "redemption-uses/"
+	customerKeyPrefix   = "redemption-customer/"
+)
+
+// NewLedger keeps redemptions in db, counting codes that normalize alike
+// under policy as one code.
+func NewLedger(db *pebble.DB, policy index.Policy) *Ledger {
+	return &Ledger{db: db, policy: policy}
+}
+
+// normalize applies the ledger's policy, leaving codes it rejects as they
+// are.
+func (l *Ledger) normalize(code string) string {
+	if normalized, ok := l.policy.Normalize(code); ok {
+		return normalized
+	}
+	return code
+}
+
+func redemptionKey(code, orderID string) []byte {
+	return []byte(redemptionKeyPrefix + code + "/" + orderID)
+}
+
+func usesKey(code string) []byte {
+	return []byte(usesKeyPrefix + code)
+}
+
+func customerKey(code, customerID string) []byte {
+	return []byte(customerKeyPrefix + code + "/" + customerID)
+}
+
+// Redeem records r if the code still has uses left under limits, and
+// returns ErrUsageLimitReached otherwise. A per-customer limit needs
+// r.CustomerID, or ErrCustomerRequired is returned. A code or customer ID
+// containing "/" is refused with ErrKeySeparator.
+func (l *Ledger) Redeem(r Redemption, limits Limits) error {
+	r.Code = l.normalize(r.Code)
+	if strings.Contains(r.Code, "/") || strings.Contains(r.CustomerID, "/") {
+		return ErrKeySeparator
+	}
+	if limits.MaxUsesPerCustomer > 0 && r.CustomerID == "" {
+		return ErrCustomerRequired
+	}
+	if r.RedeemedAt.IsZero() {
+		r.RedeemedAt = time.Now().UTC()
+	}
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	uses, err := l.count(usesKey(r.Code))
+	if err != nil {
+		return err
+	}
+	if limits.MaxUses > 0 && uses >= uint64(limits.MaxUses) {
+		return ErrUsageLimitReached
+	}
+
+	batch := l.db.NewBatch()
+	defer batch.Close()
+	if r.CustomerID != "" {
+		key := customerKey(r.Code, r.CustomerID)
+		customerUses, err := l.count(key)
+		if err != nil {
+			return err
+		}
+		if limits.MaxUsesPerCustomer > 0 && customerUses >= uint64(limits.MaxUsesPerCustomer) {
+			return ErrUsageLimitReached
+		}
+		_ = batch.Set(key, encodeCount(customerUses+1), nil)
+	}
+	_ = batch.Set(usesKey(r.Code), encodeCount(uses+1), nil)
+	_ = batch.Set(redemptionKey(r.Code, r.OrderID), value, nil)
+	return batch.Commit(pebble.Sync)
+}
+
+// Release undoes the redemption of code by orderID, for orders that could
+// not be saved. Releasing an unknown redemption is a no-op.
+func (l *Ledger) Release(code, orderID string) error {
+	code = l.normalize(code)
+	if strings.Contains(code, "/") {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	value, closer, err := l.db.Get(redemptionKey(code, orderID))
+	if errors.Is(err, pebble.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var r Redemption
+	err = json.Unmarshal(value, &r)
+	closer.Close()
+	if err != nil {
+		return err
+	}
+
+	batch := l.db.NewBatch()
+	defer batch.Close()
+	if err := l.decrement(batch, usesKey(code)); err != nil {
+		return err
+	}
+	if r.CustomerID != "" {
+		if err := l.decrement(batch, customerKey(code, r.CustomerID)); err != nil {
+			return err
+		}
+	}
+	_ = batch.Delete(redemptionKey(code, orderID), nil)
+	return batch.Commit(pebble.Sync)
+}
+
+// Uses returns how many times code has been redeemed.
+func (l *Ledger) Uses(code string) (int, error) {
+	n, err := l.count(usesKey(l.normalize(code)))
+	return int(n), err
+}
+
+// Redemptions lists the orders that redeemed code.
+func (l *Ledger) Redemptions(code string) ([]Redemption, error) {
+	prefix := redemptionKeyPrefix + l.normalize(code) + "/"
+	iter, err := l.db.NewIter(&pebble.IterOptions{LowerBound: []byte(prefix), UpperBound: index.PrefixUpperBound(prefix)})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	redemptions := []Redemption{}
+	for iter.First(); iter.Valid(); iter.Next() {
+		var r Redemption
+		if err := json.Unmarshal(iter.Value(), &r); err != nil {
+			return nil, err
+		}
+		redemptions = append(redemptions, r)
+	}
+	return redemptions, iter.Error()
+}
+
+func (l *Ledger) count(key []byte) (uint64, error) {
+	value, closer, err := l.db.Get(key)
+	if errors.Is(err, pebble.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer closer.Close()
+	if len(value) != 8 {
+		return 0, errors.New("malformed redemption counter")
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
+
+func (l *Ledger) decrement(batch *pebble.Batch, key []byte) error {
+	n, err := l.count(key)
+	if err != nil || n == 0 {
+		return err
+	}
+	if n == 1 {
+		return batch.Delete(key, nil)
+	}
+	return batch.Set(key, encodeCount(n-1), nil)
+}
+
+func encodeCount(n uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, n)
+}
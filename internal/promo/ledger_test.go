@@ -0,0 +1,166 @@
+package promo
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/PerumallaGiridhar/oolio/internal/index"
+	"github.com/cockroachdb/pebble"
+)
+
+func newTestLedger(t *testing.T) *Ledger {
+	t.Helper()
+	db, err := pebble.Open(t.TempDir(), &pebble.Options{})
+	if err != nil {
+		t.Fatalf("failed to open pebble: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewLedger(db, index.Policy{})
+}
+
+func TestLedger_SingleUse(t *testing.T) {
+	l := newTestLedger(t)
+	limits := Limits{MaxUses: 1}
+
+	if err := l.Redeem(Redemption{Code: "once0001", OrderID: "order-1"}, limits); err != nil {
+		t.Fatalf("first Redeem error: %v", err)
+	}
+	if err := l.Redeem(Redemption{Code: "ONCE0001", OrderID: "order-2"}, limits); !errors.Is(err, ErrUsageLimitReached) {
+		t.Fatalf("second Redeem error = %v, want ErrUsageLimitReached", err)
+	}
+
+	redemptions, err := l.Redemptions("ONCE0001")
+	if err != nil {
+		t.Fatalf("Redemptions error: %v", err)
+	}
+	if len(redemptions) != 1 || redemptions[0].OrderID != "order-1" || redemptions[0].Code != "ONCE0001" {
+		t.Fatalf("Redemptions = %+v, want one for order-1", redemptions)
+	}
+}
+
+func TestLedger_MaxUsesAndRelease(t *testing.T) {
+	l := newTestLedger(t)
+	limits := Limits{MaxUses: 2}
+
+	for i := 1; i <= 2; i++ {
+		if err := l.Redeem(Redemption{Code: "TWICE001", OrderID: fmt.Sprintf("order-%d", i)}, limits); err != nil {
+			t.Fatalf("Redeem %d error: %v", i, err)
+		}
+	}
+	if err := l.Redeem(Redemption{Code: "TWICE001", OrderID: "order-3"}, limits); !errors.Is(err, ErrUsageLimitReached) {
+		t.Fatalf("third Redeem error = %v, want ErrUsageLimitReached", err)
+	}
+
+	if err := l.Release("TWICE001", "order-2"); err != nil {
+		t.Fatalf("Release error: %v", err)
+	}
+	if uses, _ := l.Uses("TWICE001"); uses != 1 {
+		t.Fatalf("Uses after release = %d, want 1", uses)
+	}
+	if err := l.Release("TWICE001", "unknown"); err != nil {
+		t.Fatalf("Release of unknown redemption error: %v", err)
+	}
+	if err := l.Redeem(Redemption{Code: "TWICE001", OrderID: "order-3"}, limits); err != nil {
+		t.Fatalf("Redeem after release error: %v", err)
+	}
+}
+
+func TestLedger_PerCustomerLimit(t *testing.T) {
+	l := newTestLedger(t)
+	limits := Limits{MaxUsesPerCustomer: 1}
+
+	if err := l.Redeem(Redemption{Code: "WELCOME1", OrderID: "order-1"}, limits); !errors.Is(err, ErrCustomerRequired) {
+		t.Fatalf("Redeem without customer error = %v, want ErrCustomerRequired", err)
+	}
+	if err := l.Redeem(Redemption{Code: "WELCOME1", OrderID: "order-1", CustomerID: "alice"}, limits); err != nil {
+		t.Fatalf("Redeem for alice error: %v", err)
+	}
+	if err := l.Redeem(Redemption{Code: "WELCOME1", OrderID: "order-2", CustomerID: "alice"}, limits); !errors.Is(err, ErrUsageLimitReached) {
+		t.Fatalf("second Redeem for alice error = %v, want ErrUsageLimitReached", err)
+	}
+	if err := l.Redeem(Redemption{Code: "WELCOME1", OrderID: "order-3", CustomerID: "bob"}, limits); err != nil {
+		t.Fatalf("Redeem for bob error: %v", err)
+	}
+
+	if err := l.Release("WELCOME1", "order-1"); err != nil {
+		t.Fatalf("Release error: %v", err)
+	}
+	if err := l.Redeem(Redemption{Code: "WELCOME1", OrderID: "order-4", CustomerID: "alice"}, limits); err != nil {
+		t.Fatalf("Redeem for alice after release error: %v", err)
+	}
+}
+
+func TestLedger_RejectsKeySeparator(t *testing.T) {
+	l := newTestLedger(t)
+	limits := Limits{MaxUsesPerCustomer: 1}
+
+	// "WELCOME1/alice" with customer "x" would otherwise share a key prefix
+	// with customer "alice/x" of WELCOME1.
+	for _, r := range []Redemption{
+		{Code: "WELCOME1/alice", OrderID: "order-1", CustomerID: "x"},
+		{Code: "WELCOME1", OrderID: "order-2", CustomerID: "alice/x"},
+	} {
+		if err := l.Redeem(r, limits); !errors.Is(err, ErrKeySeparator) {
+			t.Errorf("Redeem(%q, %q) error = %v, want ErrKeySeparator", r.Code, r.CustomerID, err)
+		}
+	}
+	if uses, _ := l.Uses("WELCOME1"); uses != 0 {
+		t.Errorf("Uses(WELCOME1) = %d, want 0", uses)
+	}
+}
+
+func TestLedger_ConcurrentSingleUse(t *testing.T) {
+	l := newTestLedger(t)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		successes int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := l.Redeem(Redemption{Code: "RACE0001", OrderID: fmt.Sprintf("order-%d", i)}, Limits{MaxUses: 1})
+			if err == nil {
+				mu.Lock()
+				successes++
+				mu.Unlock()
+			} else if !errors.Is(err, ErrUsageLimitReached) {
+				t.Errorf("Redeem error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if successes != 1 {
+		t.Fatalf("successful redemptions = %d, want 1", successes)
+	}
+}
+
+func TestLedger_CountsCodesByPolicy(t *testing.T) {
+	db, err := pebble.Open(t.TempDir(), &pebble.Options{})
+	if err != nil {
+		t.Fatalf("failed to open pebble: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	limits := Limits{MaxUses: 1}
+
+	// With case-sensitive codes, abcdefgh and ABCDEFGH are different coupons.
+	l := NewLedger(db, index.Policy{Case: index.CaseNone, Strip: "-"})
+	if err := l.Redeem(Redemption{Code: "abcd-efgh", OrderID: "order-1"}, limits); err != nil {
+		t.Fatalf("Redeem(abcd-efgh) error: %v", err)
+	}
+	if err := l.Redeem(Redemption{Code: "ABCDEFGH", OrderID: "order-2"}, limits); err != nil {
+		t.Fatalf("Redeem(ABCDEFGH) error: %v", err)
+	}
+	// Stripped characters still count as the same code.
+	if err := l.Redeem(Redemption{Code: "abcdefgh", OrderID: "order-3"}, limits); !errors.Is(err, ErrUsageLimitReached) {
+		t.Fatalf("Redeem(abcdefgh) error = %v, want ErrUsageLimitReached", err)
+	}
+	if uses, _ := l.Uses("abcd-efgh"); uses != 1 {
+		t.Errorf("Uses(abcd-efgh) = %d, want 1", uses)
+	}
+}
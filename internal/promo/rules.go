@@ -0,0 +1,185 @@
+package promo
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/PerumallaGiridhar/oolio/internal/data"
+	"github.com/PerumallaGiridhar/oolio/internal/index"
+)
+
+type RuleType string
+
+const (
+	RulePercentage   RuleType = "percentage"
+	RuleFixed        RuleType = "fixed"
+	RuleFreeCheapest RuleType = "free_cheapest"
+	RuleBOGO         RuleType = "bogo"
+)
+
+// Rule maps promo codes to a discount. A rule matches a code exactly
+// (Code), by prefix (Prefix), or matches every code when both are empty.
+// MaxUses and MaxUsesPerCustomer limit how often each matching code can be
+// redeemed; zero means unlimited and MaxUses 1 makes codes single-use.
+type Rule struct {
+	Code               string     `json:"code,omitempty"`
+	Prefix             string     `json:"prefix,omitempty"`
+	Type               RuleType   `json:"type"`
+	Percent            int        `json:"percent,omitempty"`
+	Amount             data.Money `json:"amount,omitempty"`
+	Category           string     `json:"category,omitempty"`
+	MaxUses            int        `json:"maxUses,omitempty"`
+	MaxUsesPerCustomer int        `json:"maxUsesPerCustomer,omitempty"`
+}
+
+// Line is one priced order line as seen by the rules.
+type Line struct {
+	ProductID string
+	Category  string
+	UnitPrice data.Money
+	Quantity  int
+}
+
+type rulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// normalizeRuleCode normalizes a rule's code or prefix with policy. An
+// empty field stays empty.
+func normalizeRuleCode(policy index.Policy, code string) (string, error) {
+	if strings.TrimSpace(code) == "" {
+		return "", nil
+	}
+	normalized, ok := policy.Normalize(code)
+	if !ok {
+		return "", fmt.Errorf("code %q is empty once normalized", code)
+	}
+	return normalized, nil
+}
+
+func (r Rule) matches(code string) bool {
+	switch {
+	case r.Code != "":
+		return r.Code == code
+	case r.Prefix != "":
+		return strings.HasPrefix(code, r.Prefix)
+	default:
+		return true
+	}
+}
+
+func (r Rule) validate() error {
+	if r.Code != "" && r.Prefix != "" {
+		return fmt.Errorf("rule may set code or prefix, not both")
+	}
+	if r.MaxUses < 0 || r.MaxUsesPerCustomer < 0 {
+		return fmt.Errorf("usage limits must not be negative")
+	}
+	switch r.Type {
+	case RulePercentage:
+		if r.Percent <= 0 || r.Percent > 100 {
+			return fmt.Errorf("percentage rule needs percent in 1..100, got %d", r.Percent)
+		}
+	case RuleFixed:
+		if r.Amount <= 0 {
+			return fmt.Errorf("fixed rule needs a positive amount")
+		}
+	case RuleFreeCheapest:
+	case RuleBOGO:
+		if r.Category == "" {
+			return fmt.Errorf("bogo rule needs a category")
+		}
+	default:
+		return fmt.Errorf("unknown rule type %q", r.Type)
+	}
+	return nil
+}
+
+// Limits returns the redemption limits for codes matching this rule.
+func (r Rule) Limits() Limits {
+	return Limits{MaxUses: r.MaxUses, MaxUsesPerCustomer: r.MaxUsesPerCustomer}
+}
+
+// Discount returns the amount taken off lines by this rule. The caller caps
+// it at the order subtotal.
+func (r Rule) Discount(lines []Line) data.Money {
+	var subtotal data.Money
+	units := 0
+	for _, l := range lines {
+		subtotal += l.UnitPrice.Times(l.Quantity)
+		units += l.Quantity
+	}
+
+	switch r.Type {
+	case RulePercentage:
+		return subtotal.BasisPoints(r.Percent * 100)
+	case RuleFixed:
+		return min(r.Amount, subtotal)
+	case RuleFreeCheapest:
+		// Only applies to multi-item orders, otherwise the whole order is free.
+		if units < 2 {
+			return 0
+		}
+		cheapest := lines[0].UnitPrice
+		for _, l := range lines[1:] {
+			cheapest = min(cheapest, l.UnitPrice)
+		}
+		return cheapest
+	case RuleBOGO:
+		matching := make([]Line, 0, len(lines))
+		for _, l := range lines {
+			if strings.EqualFold(l.Category, r.Category) && l.Quantity > 0 {
+				matching = append(matching, l)
+			}
+		}
+		// Pair units from most to least expensive; the cheaper of each pair
+		// is free. Units are numbered in that order and every odd-numbered
+		// one is free, so each line is counted without listing its units.
+		slices.SortFunc(matching, func(a, b Line) int { return cmp.Compare(b.UnitPrice, a.UnitPrice) })
+		var free data.Money
+		pos := 0
+		for _, l := range matching {
+			freeUnits := (pos+l.Quantity)/2 - pos/2
+			free += l.UnitPrice.Times(freeUnits)
+			pos += l.Quantity
+		}
+		return free
+	}
+	return 0
+}
+
+// LoadRules reads a JSON rules file of the form {"rules": [...]}. Rule
+// codes and prefixes are normalized with policy, so they match codes the
+// way the promo index does.
+func LoadRules(path string, policy index.Policy) ([]Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var file rulesFile
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	for i := range file.Rules {
+		var err error
+		if file.Rules[i].Code, err = normalizeRuleCode(policy, file.Rules[i].Code); err != nil {
+			return nil, fmt.Errorf("rule %d in %s: %w", i, path, err)
+		}
+		if file.Rules[i].Prefix, err = normalizeRuleCode(policy, file.Rules[i].Prefix); err != nil {
+			return nil, fmt.Errorf("rule %d in %s: %w", i, path, err)
+		}
+		if err := file.Rules[i].validate(); err != nil {
+			return nil, fmt.Errorf("rule %d in %s: %w", i, path, err)
+		}
+	}
+	return file.Rules, nil
+}
@@ -0,0 +1,165 @@
+package promo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PerumallaGiridhar/oolio/internal/data"
+	"github.com/PerumallaGiridhar/oolio/internal/index"
+)
+
+func writeRulesFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write rules file: %v", err)
+	}
+	return path
+}
+
+func TestRule_Discount(t *testing.T) {
+	lines := []Line{
+		{ProductID: "1", Category: "Waffle", UnitPrice: 650, Quantity: 1},
+		{ProductID: "7", Category: "Cake", UnitPrice: 450, Quantity: 3},
+		{ProductID: "8", Category: "Brownie", UnitPrice: 400, Quantity: 1},
+	}
+	// subtotal = 6.50 + 13.50 + 4.00 = 24.00
+
+	tests := []struct {
+		name string
+		rule Rule
+		want data.Money
+	}{
+		{"percentage", Rule{Type: RulePercentage, Percent: 10}, 240},
+		{"fixed", Rule{Type: RuleFixed, Amount: 500}, 500},
+		{"fixed capped at subtotal", Rule{Type: RuleFixed, Amount: 10000}, 2400},
+		{"free cheapest", Rule{Type: RuleFreeCheapest}, 400},
+		{"bogo on category", Rule{Type: RuleBOGO, Category: "cake"}, 450},
+		{"bogo without matching items", Rule{Type: RuleBOGO, Category: "Pie"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Discount(lines); got != tt.want {
+				t.Fatalf("Discount = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	single := []Line{{ProductID: "1", UnitPrice: 650, Quantity: 1}}
+	if got := (Rule{Type: RuleFreeCheapest}).Discount(single); got != 0 {
+		t.Fatalf("free cheapest on a single item = %s, want 0", got)
+	}
+}
+
+func TestRule_DiscountBOGOPairsAcrossLines(t *testing.T) {
+	bogo := Rule{Type: RuleBOGO, Category: "Cake"}
+	lines := []Line{
+		{ProductID: "7", Category: "Cake", UnitPrice: 450, Quantity: 3},
+		{ProductID: "9", Category: "Cake", UnitPrice: 700, Quantity: 2},
+		{ProductID: "8", Category: "Cake", UnitPrice: 300, Quantity: 1},
+	}
+	// Units by price: 700 700 | 450 450 | 450 300, so one of each pair is free.
+	if got := bogo.Discount(lines); got != 700+450+300 {
+		t.Fatalf("Discount = %s, want 14.50", got)
+	}
+
+	// Huge quantities are counted, not expanded into units.
+	huge := []Line{
+		{ProductID: "7", Category: "Cake", UnitPrice: 450, Quantity: 2_000_000_000},
+		{ProductID: "8", Category: "Cake", UnitPrice: 300, Quantity: 3},
+	}
+	allocs := testing.AllocsPerRun(5, func() { bogo.Discount(huge) })
+	if got, want := bogo.Discount(huge), data.Money(450).Times(1_000_000_000)+300; got != want {
+		t.Fatalf("Discount = %s, want %s", got, want)
+	}
+	if allocs > 1 {
+		t.Errorf("Discount allocated %v times for a huge quantity", allocs)
+	}
+}
+
+func TestLoadRules_ValidatesRules(t *testing.T) {
+	if _, err := LoadRules(writeRulesFile(t, `{"rules":[{"type":"percentage","percent":150}]}`), index.Policy{}); err == nil {
+		t.Fatalf("expected error for percent > 100")
+	}
+	if _, err := LoadRules(writeRulesFile(t, `{"rules":[{"type":"mystery"}]}`), index.Policy{}); err == nil {
+		t.Fatalf("expected error for unknown rule type")
+	}
+	if _, err := LoadRules(writeRulesFile(t, `{"rules":[{"type":"bogo"}]}`), index.Policy{}); err == nil {
+		t.Fatalf("expected error for bogo rule without category")
+	}
+	if _, err := LoadRules(writeRulesFile(t, `{"rules":[{"type":"free_cheapest","maxUses":-1}]}`), index.Policy{}); err == nil {
+		t.Fatalf("expected error for negative maxUses")
+	}
+}
+
+func TestEngine_MatchOrder(t *testing.T) {
+	path := writeRulesFile(t, `{"rules":[
+		{"code":"happyhrs","type":"percentage","percent":18},
+		{"prefix":"FIFTY","type":"fixed","amount":5},
+		{"type":"free_cheapest"}
+	]}`)
+
+	e, err := NewEngine(path, index.Policy{})
+	if err != nil {
+		t.Fatalf("NewEngine error: %v", err)
+	}
+
+	cases := map[string]RuleType{
+		"HAPPYHRS":   RulePercentage,
+		" happyhrs ": RulePercentage,
+		"FIFTYOFF":   RuleFixed,
+		"SUPER100":   RuleFreeCheapest,
+	}
+	for code, want := range cases {
+		rule, ok := e.Match(code)
+		if !ok || rule.Type != want {
+			t.Errorf("Match(%q) = %v, %v; want %v", code, rule.Type, ok, want)
+		}
+	}
+}
+
+func TestEngine_MatchUsesPolicy(t *testing.T) {
+	path := writeRulesFile(t, `{"rules":[
+		{"code":"HAPPY-HRS","type":"percentage","percent":18},
+		{"prefix":"fifty-","type":"fixed","amount":5}
+	]}`)
+
+	// Rules written with dashes match codes normalized without them.
+	e, err := NewEngine(path, index.Policy{Strip: "-"})
+	if err != nil {
+		t.Fatalf("NewEngine error: %v", err)
+	}
+	for code, want := range map[string]RuleType{"HAPPYHRS": RulePercentage, "happy-hrs": RulePercentage, "FIFTYOFF": RuleFixed} {
+		if rule, ok := e.Match(code); !ok || rule.Type != want {
+			t.Errorf("Match(%q) = %v, %v; want %v", code, rule.Type, ok, want)
+		}
+	}
+
+	// Case-sensitive codes only match as written.
+	e, err = NewEngine(writeRulesFile(t, `{"rules":[{"code":"HappyHrs","type":"percentage","percent":18}]}`), index.Policy{Case: index.CaseNone})
+	if err != nil {
+		t.Fatalf("NewEngine error: %v", err)
+	}
+	if _, ok := e.Match("HappyHrs"); !ok {
+		t.Errorf("expected HappyHrs to match")
+	}
+	if _, ok := e.Match("HAPPYHRS"); ok {
+		t.Errorf("expected HAPPYHRS not to match a case-sensitive rule")
+	}
+
+	if _, err := LoadRules(writeRulesFile(t, `{"rules":[{"code":"---","type":"percentage","percent":5}]}`), index.Policy{Strip: "-"}); err == nil {
+		t.Errorf("expected error for a code that normalizes to nothing")
+	}
+}
+
+func TestNewEngine_EmptyPathHasNoRules(t *testing.T) {
+	e, err := NewEngine("", index.Policy{})
+	if err != nil {
+		t.Fatalf("NewEngine error: %v", err)
+	}
+	if _, ok := e.Match("HAPPYHRS"); ok {
+		t.Fatalf("expected no rule to match")
+	}
+}
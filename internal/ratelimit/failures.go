@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"expvar"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/PerumallaGiridhar/oolio/internal/response"
+)
+
+// FailureStats counts failed coupon attempts since the process started.
+type FailureStats struct {
+	Failures int64 `json:"failures"`
+	Lockouts int64 `json:"lockouts"`
+	Blocked  int64 `json:"blocked"`
+}
+
+var failureCounters struct {
+	failures, lockouts, blocked atomic.Int64
+}
+
+func init() {
+	expvar.Publish("promo_failures", expvar.Func(func() any { return ReadFailureStats() }))
+}
+
+// ReadFailureStats returns the failure counters of every tracker.
+func ReadFailureStats() FailureStats {
+	return FailureStats{
+		Failures: failureCounters.failures.Load(),
+		Lockouts: failureCounters.lockouts.Load(),
+		Blocked:  failureCounters.blocked.Load(),
+	}
+}
+
+// FailureTracker locks out clients that keep failing, tracking them by
+// client IP. Once a client reaches limit failures it is locked out for
+// base, doubling with every further failure up to maxLockout. A client's
+// failures are forgotten once it has gone maxLockout without failing.
+type FailureTracker struct {
+	// IPHeader names the header a trusted proxy puts the client address
+	// in, as for Limiter. Empty uses the connection's address.
+	IPHeader string
+
+	limit            int
+	base, maxLockout time.Duration
+	now              func() time.Time
+
+	mu        sync.Mutex
+	clients   map[string]*failureRecord
+	lastSweep time.Time
+}
+
+type failureRecord struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+func NewFailureTracker(limit int, base, maxLockout time.Duration) *FailureTracker {
+	return &FailureTracker{
+		limit:      max(limit, 1),
+		base:       base,
+		maxLockout: max(base, maxLockout),
+		now:        time.Now,
+		clients:    make(map[string]*failureRecord),
+	}
+}
+
+// Fail records a failed attempt by the client behind r.
+func (t *FailureTracker) Fail(r *http.Request) {
+	failureCounters.failures.Add(1)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	t.sweep(now)
+	key := ClientIP(r, t.IPHeader)
+	rec, ok := t.clients[key]
+	if !ok {
+		rec = &failureRecord{}
+		t.clients[key] = rec
+	}
+	rec.count++
+	rec.last = now
+	if rec.count >= t.limit {
+		rec.lockedUntil = now.Add(t.lockout(rec.count - t.limit))
+		failureCounters.lockouts.Add(1)
+	}
+}
+
+// lockout is base doubled n times, capped at maxLockout.
+func (t *FailureTracker) lockout(n int) time.Duration {
+	d := t.base
+	for i := 0; i < n && d < t.maxLockout; i++ {
+		d *= 2
+	}
+	return min(d, t.maxLockout)
+}
+
+// Blocked reports whether the client behind r is locked out and for how
+// much longer.
+func (t *FailureTracker) Blocked(r *http.Request) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	rec, ok := t.clients[ClientIP(r, t.IPHeader)]
+	if !ok || !now.Before(rec.lockedUntil) {
+		return 0, false
+	}
+	return rec.lockedUntil.Sub(now), true
+}
+
+// sweep forgets clients that have gone maxLockout without failing, at most
+// once a minute.
+func (t *FailureTracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < time.Minute {
+		return
+	}
+	t.lastSweep = now
+	for key, rec := range t.clients {
+		if now.Sub(rec.last) >= t.maxLockout && !now.Before(rec.lockedUntil) {
+			delete(t.clients, key)
+		}
+	}
+}
+
+// Middleware rejects requests from locked out clients with 429 and a
+// Retry-After header.
+func (t *FailureTracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait, blocked := t.Blocked(r); blocked {
+			failureCounters.blocked.Add(1)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			response.JSONErrorResponse(w, http.StatusTooManyRequests, "too many failed coupon attempts")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newRequest(ip string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.RemoteAddr = ip + ":1234"
+	return r
+}
+
+func TestFailureTracker_LockoutDoublesUpToMax(t *testing.T) {
+	now := time.Unix(0, 0)
+	ft := NewFailureTracker(3, 10*time.Second, 30*time.Second)
+	ft.now = func() time.Time { return now }
+	r := newRequest("192.0.2.1")
+
+	for i := 0; i < 2; i++ {
+		ft.Fail(r)
+	}
+	if _, blocked := ft.Blocked(r); blocked {
+		t.Fatalf("blocked before reaching the limit")
+	}
+
+	for _, want := range []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second, 30 * time.Second} {
+		ft.Fail(r)
+		wait, blocked := ft.Blocked(r)
+		if !blocked || wait != want {
+			t.Fatalf("Blocked = %v, %v; want %v, true", wait, blocked, want)
+		}
+	}
+
+	now = now.Add(30 * time.Second)
+	if _, blocked := ft.Blocked(r); blocked {
+		t.Fatalf("still blocked after the lockout ended")
+	}
+	now = now.Add(time.Minute)
+	ft.Fail(newRequest("192.0.2.9"))
+	if _, ok := ft.clients["192.0.2.1"]; ok {
+		t.Fatalf("expected idle client to be forgotten")
+	}
+}
+
+func TestFailureTracker_Middleware(t *testing.T) {
+	ft := NewFailureTracker(1, 5*time.Second, time.Minute)
+	h := ft.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	before := ReadFailureStats()
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, newRequest("192.0.2.1"))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204 before any failure got %d", rr.Code)
+	}
+
+	ft.Fail(newRequest("192.0.2.1"))
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, newRequest("192.0.2.1"))
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "5" {
+		t.Fatalf("got status %d, Retry-After %q; want 429, 5", rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	after := ReadFailureStats()
+	if after.Failures-before.Failures != 1 || after.Lockouts-before.Lockouts != 1 || after.Blocked-before.Blocked != 1 {
+		t.Errorf("unexpected counter changes: before %+v, after %+v", before, after)
+	}
+}
+
+func TestFailureTracker_SeparatesClientsBehindOneProxy(t *testing.T) {
+	ft := NewFailureTracker(1, time.Minute, time.Hour)
+	ft.IPHeader = "Fly-Client-IP"
+	behindProxy := func(client string) *http.Request {
+		r := newRequest("172.16.0.1") // the proxy
+		r.Header.Set("Fly-Client-IP", client)
+		return r
+	}
+
+	ft.Fail(behindProxy("198.51.100.1"))
+	if _, blocked := ft.Blocked(behindProxy("198.51.100.1")); !blocked {
+		t.Errorf("expected the failing client to be locked out")
+	}
+	if _, blocked := ft.Blocked(behindProxy("198.51.100.2")); blocked {
+		t.Errorf("expected another client behind the same proxy not to be locked out")
+	}
+}
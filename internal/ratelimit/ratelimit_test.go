@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiter_RefillsAtRate(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := New(60, 2)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d within burst was limited", i+1)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok || wait != time.Second {
+		t.Fatalf("Allow after burst = %v, %v; want false, 1s", ok, wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Fatalf("another client was limited")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatalf("expected a token after one second")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatalf("expected only one token after one second")
+	}
+}
+
+func TestLimiter_SweepsIdleBuckets(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := New(60, 5)
+	l.now = func() time.Time { return now }
+
+	l.Allow("a")
+	now = now.Add(2 * time.Minute)
+	l.Allow("b")
+	if _, ok := l.buckets["a"]; ok {
+		t.Fatalf("expected idle bucket to be swept")
+	}
+}
+
+func TestMiddleware_Returns429WithRetryAfter(t *testing.T) {
+	l := New(30, 1)
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	codes := make([]int, 2)
+	for i := range codes {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		codes[i] = rr.Code
+		if rr.Code == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "2" {
+			t.Errorf("Retry-After = %q, want 2", rr.Header().Get("Retry-After"))
+		}
+	}
+	if codes[0] != http.StatusNoContent || codes[1] != http.StatusTooManyRequests {
+		t.Fatalf("got statuses %v, want [204 429]", codes)
+	}
+}
+
+func TestClientIP_TrustedHeader(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	if got := ClientIP(r, "Fly-Client-IP"); got != "10.0.0.1" {
+		t.Errorf("ClientIP without the header = %q, want the remote address", got)
+	}
+	r.Header.Set("Fly-Client-IP", "198.51.100.7")
+	if got := ClientIP(r, ""); got != "10.0.0.1" {
+		t.Errorf("ClientIP with no trusted header = %q, want the remote address", got)
+	}
+	if got := ClientIP(r, "Fly-Client-IP"); got != "198.51.100.7" {
+		t.Errorf("ClientIP = %q, want 198.51.100.7", got)
+	}
+	r.Header.Set("X-Forwarded-For", "203.0.113.5, 198.51.100.8")
+	if got := ClientIP(r, "X-Forwarded-For"); got != "198.51.100.8" {
+		t.Errorf("ClientIP = %q, want the last forwarded address", got)
+	}
+	r.Header.Set("Fly-Client-IP", "not-an-ip")
+	if got := ClientIP(r, "Fly-Client-IP"); got != "10.0.0.1" {
+		t.Errorf("ClientIP with an invalid header = %q, want the remote address", got)
+	}
+}
+
+func TestMiddleware_SeparatesClientsBehindOneProxy(t *testing.T) {
+	l := New(30, 1)
+	l.IPHeader = "Fly-Client-IP"
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	send := func(client string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = "172.16.0.1:443" // the proxy
+		req.Header.Set("Fly-Client-IP", client)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := send("198.51.100.1"); code != http.StatusNoContent {
+		t.Fatalf("first client: got %d, want 204", code)
+	}
+	if code := send("198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("first client again: got %d, want 429", code)
+	}
+	if code := send("198.51.100.2"); code != http.StatusNoContent {
+		t.Fatalf("second client behind the same proxy: got %d, want 204", code)
+	}
+}
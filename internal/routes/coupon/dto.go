@@ -0,0 +1,34 @@
+package coupon
+
+import (
+	"github.com/PerumallaGiridhar/oolio/internal/data"
+	"github.com/PerumallaGiridhar/oolio/internal/promo"
+)
+
+// Item is capped like order.OrderItem, so previews cannot overflow the
+// discount arithmetic.
+type Item struct {
+	ProductID string `json:"productId" validate:"required"`
+	Quantity  int    `json:"quantity" validate:"required,min=1,max=1000"`
+}
+
+// ValidateRequest asks whether a coupon works. Items are optional and only
+// used to preview the discount.
+type ValidateRequest struct {
+	CouponCode string `json:"couponCode" validate:"required,max=64"`
+	Items      []Item `json:"items,omitempty" validate:"omitempty,max=100,dive"`
+}
+
+type ValidateResponse struct {
+	CouponCode string `json:"couponCode"`
+	Valid      bool   `json:"valid"`
+	// Status is "active", "expired", "not_yet_active" or "invalid".
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	// MatchedStores names the promo sources containing the code, when the
+	// backend can tell.
+	MatchedStores []string    `json:"matchedStores,omitempty"`
+	Rule          *promo.Rule `json:"rule,omitempty"`
+	Subtotal      *data.Money `json:"subtotal,omitempty"`
+	Discount      *data.Money `json:"discount,omitempty"`
+}
@@ -0,0 +1,109 @@
+package coupon
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/PerumallaGiridhar/oolio/internal/binding"
+	"github.com/PerumallaGiridhar/oolio/internal/data"
+	"github.com/PerumallaGiridhar/oolio/internal/index"
+	"github.com/PerumallaGiridhar/oolio/internal/promo"
+	"github.com/PerumallaGiridhar/oolio/internal/ratelimit"
+	"github.com/PerumallaGiridhar/oolio/internal/response"
+)
+
+type Handler struct {
+	Coupons index.PromoIndex
+	// Products prices the items of a discount preview.
+	Products data.ProductRepository
+	// Rules previews the discount of a valid coupon. Nil means no preview.
+	Rules *promo.Engine
+	// Limiter throttles validation per client so the endpoint cannot be
+	// used to enumerate codes. Nil disables rate limiting.
+	Limiter *ratelimit.Limiter
+	// Failures counts coupons that are not active per client and locks out
+	// clients that keep guessing. Nil disables lockouts.
+	Failures *ratelimit.FailureTracker
+	// Policy normalizes coupon codes before rules are matched.
+	Policy index.Policy
+}
+
+func (h *Handler) ValidateCoupon(w http.ResponseWriter, r *http.Request) {
+	var req ValidateRequest
+	if err := binding.BindAndValidateJSONRequest(r, &req); err != nil {
+		response.JSONValidationErrorResponse(w, err)
+		return
+	}
+	if h.Coupons == nil {
+		response.JSONErrorResponse(w, http.StatusServiceUnavailable, "promo service unavailable")
+		return
+	}
+	if code, ok := h.Policy.Normalize(req.CouponCode); ok {
+		req.CouponCode = code
+	}
+
+	var lines []promo.Line
+	for _, item := range req.Items {
+		product, err := h.Products.Get(item.ProductID)
+		if errors.Is(err, data.ErrProductNotFound) {
+			response.JSONErrorResponse(w, http.StatusBadRequest, "ProductId does not exists")
+			return
+		}
+		if err != nil {
+			log.Printf("loading product %s: %v", item.ProductID, err)
+			response.JSONErrorResponse(w, http.StatusInternalServerError, "failed to load product")
+			return
+		}
+		lines = append(lines, promo.Line{
+			ProductID: item.ProductID,
+			Category:  product.Category,
+			UnitPrice: product.Price,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	status, err := h.Coupons.Lookup(r.Context(), req.CouponCode, time.Now())
+	if err != nil {
+		log.Printf("checking coupon %q: %v", req.CouponCode, err)
+		response.JSONErrorResponse(w, http.StatusServiceUnavailable, "promo service unavailable")
+		return
+	}
+	res := ValidateResponse{
+		CouponCode: req.CouponCode,
+		Valid:      status == index.StatusActive,
+		Status:     status.String(),
+	}
+	if err := promo.StatusError(status); err != nil {
+		res.Message = err.Error()
+		if h.Failures != nil {
+			h.Failures.Fail(r)
+		}
+	}
+
+	if matcher, ok := h.Coupons.(index.StoreMatcher); ok && status != index.StatusInvalid {
+		res.MatchedStores, err = matcher.MatchingStores(r.Context(), req.CouponCode)
+		if err != nil {
+			log.Printf("matching stores for coupon %q: %v", req.CouponCode, err)
+			response.JSONErrorResponse(w, http.StatusServiceUnavailable, "promo service unavailable")
+			return
+		}
+	}
+
+	if res.Valid && h.Rules != nil {
+		if rule, ok := h.Rules.Match(req.CouponCode); ok {
+			res.Rule = &rule
+			if len(lines) > 0 {
+				var subtotal data.Money
+				for _, line := range lines {
+					subtotal += line.UnitPrice.Times(line.Quantity)
+				}
+				discount := min(max(rule.Discount(lines), 0), subtotal)
+				res.Subtotal, res.Discount = &subtotal, &discount
+			}
+		}
+	}
+
+	response.JSONResponse(w, http.StatusOK, res)
+}
@@ -0,0 +1,19 @@
+package coupon
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func NewRouter(h *Handler) http.Handler {
+	r := chi.NewRouter()
+	if h.Failures != nil {
+		r.Use(h.Failures.Middleware)
+	}
+	if h.Limiter != nil {
+		r.Use(h.Limiter.Middleware)
+	}
+	r.Post("/validate", h.ValidateCoupon)
+	return r
+}
@@ -0,0 +1,192 @@
+package coupon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	enlocales "github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	v10 "github.com/go-playground/validator/v10"
+	enTranslations "github.com/go-playground/validator/v10/translations/en"
+
+	"github.com/PerumallaGiridhar/oolio/internal/data"
+	"github.com/PerumallaGiridhar/oolio/internal/index"
+	"github.com/PerumallaGiridhar/oolio/internal/promo"
+	"github.com/PerumallaGiridhar/oolio/internal/ratelimit"
+	"github.com/PerumallaGiridhar/oolio/internal/validation"
+)
+
+func init() {
+	validation.Validator = v10.New()
+	uni := ut.New(enlocales.New())
+	tr, _ := uni.GetTranslator("en")
+	validation.Translator = tr
+	_ = enTranslations.RegisterDefaultTranslations(validation.Validator, validation.Translator)
+}
+
+var testProducts = data.NewMemoryProductRepository(data.DefaultProducts())
+
+func newTestIndex(t *testing.T) *index.PebbleIndex {
+	t.Helper()
+	dir := t.TempDir()
+	expired := "EXPIRED1,," + time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	sources := map[string]string{
+		"couponbase1": "FIFTYOFF\nNORULE01\n" + expired + "\n",
+		"couponbase2": "FIFTYOFF\n",
+		"couponbase3": "NORULE01\n" + expired + "\n",
+	}
+	var paths []string
+	for _, name := range []string{"couponbase1", "couponbase2", "couponbase3"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(sources[name]), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		paths = append(paths, path)
+	}
+	pi, err := index.NewPebbleIndex(paths, index.Options{Quorum: 2})
+	if err != nil {
+		t.Fatalf("NewPebbleIndex error: %v", err)
+	}
+	t.Cleanup(pi.Close)
+	return pi
+}
+
+func newTestRules(t *testing.T) *promo.Engine {
+	t.Helper()
+	rulesPath := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(rulesPath, []byte(`{"rules":[{"code":"FIFTYOFF","type":"percentage","percent":50}]}`), 0o644); err != nil {
+		t.Fatalf("failed to write rules file: %v", err)
+	}
+	rules, err := promo.NewEngine(rulesPath, index.Policy{})
+	if err != nil {
+		t.Fatalf("NewEngine error: %v", err)
+	}
+	return rules
+}
+
+func postValidate(t *testing.T, h http.Handler, req ValidateRequest) (*httptest.ResponseRecorder, ValidateResponse) {
+	t.Helper()
+	b, _ := json.Marshal(req)
+	r := httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(b))
+	r.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+
+	var res ValidateResponse
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+			t.Fatalf("Invalid json response from validate: %v", err)
+		}
+	}
+	return rr, res
+}
+
+func TestValidateCoupon(t *testing.T) {
+	r := NewRouter(&Handler{Coupons: newTestIndex(t), Products: testProducts, Rules: newTestRules(t)})
+
+	rr, res := postValidate(t, r, ValidateRequest{
+		CouponCode: "fiftyoff",
+		Items:      []Item{{ProductID: "1", Quantity: 2}},
+	})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d", rr.Code)
+	}
+	if !res.Valid || res.Status != "active" || res.Message != "" {
+		t.Errorf("unexpected result for valid coupon: %+v", res)
+	}
+	if !slices.Equal(res.MatchedStores, []string{"couponbase1", "couponbase2"}) {
+		t.Errorf("MatchedStores = %v, want [couponbase1 couponbase2]", res.MatchedStores)
+	}
+	// 2 x 6.50 = 13.00, 50% off = 6.50
+	if res.Rule == nil || res.Subtotal == nil || *res.Subtotal != 1300 || res.Discount == nil || *res.Discount != 650 {
+		t.Errorf("unexpected discount preview: %s", rr.Body.String())
+	}
+
+	_, res = postValidate(t, r, ValidateRequest{CouponCode: "NORULE01"})
+	if !res.Valid || res.Rule != nil || res.Discount != nil {
+		t.Errorf("expected valid coupon without a discount, got %+v", res)
+	}
+
+	_, res = postValidate(t, r, ValidateRequest{CouponCode: "EXPIRED1"})
+	if res.Valid || res.Status != "expired" || res.Message != "coupon expired" {
+		t.Errorf("unexpected result for expired coupon: %+v", res)
+	}
+	if !slices.Equal(res.MatchedStores, []string{"couponbase1", "couponbase3"}) {
+		t.Errorf("MatchedStores = %v, want [couponbase1 couponbase3]", res.MatchedStores)
+	}
+
+	_, res = postValidate(t, r, ValidateRequest{CouponCode: "UNKNOWN1"})
+	if res.Valid || res.Status != "invalid" || res.Message != "invalid coupon" || res.MatchedStores != nil {
+		t.Errorf("unexpected result for unknown coupon: %+v", res)
+	}
+}
+
+func TestValidateCoupon_RequestErrors(t *testing.T) {
+	r := NewRouter(&Handler{Coupons: index.NewMemoryIndexFromCodes("FIFTYOFF"), Products: testProducts})
+
+	if rr, _ := postValidate(t, r, ValidateRequest{}); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status 422 for missing coupon got %d", rr.Code)
+	}
+	if rr, _ := postValidate(t, r, ValidateRequest{CouponCode: "FIFTYOFF", Items: []Item{{ProductID: "1", Quantity: 1001}}}); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422 for a quantity over 1000 got %d", rr.Code)
+	}
+	if rr, _ := postValidate(t, r, ValidateRequest{CouponCode: "FIFTYOFF", Items: []Item{{ProductID: "999", Quantity: 1}}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for unknown product got %d", rr.Code)
+	}
+	if rr, _ := postValidate(t, NewRouter(&Handler{}), ValidateRequest{CouponCode: "FIFTYOFF"}); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 without an index got %d", rr.Code)
+	}
+	if rr, _ := postValidate(t, NewRouter(&Handler{Coupons: unavailableIndex{}}), ValidateRequest{CouponCode: "FIFTYOFF"}); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 when the lookup fails got %d", rr.Code)
+	}
+}
+
+type unavailableIndex struct{ index.PromoIndex }
+
+func (unavailableIndex) Lookup(context.Context, string, time.Time) (index.Status, error) {
+	return index.StatusInvalid, index.ErrUnavailable
+}
+
+func TestValidateCoupon_RateLimited(t *testing.T) {
+	r := NewRouter(&Handler{
+		Coupons: index.NewMemoryIndexFromCodes("FIFTYOFF"),
+		Limiter: ratelimit.New(1, 3),
+	})
+
+	for i := 0; i < 3; i++ {
+		if rr, _ := postValidate(t, r, ValidateRequest{CouponCode: "GUESS000"}); rr.Code != http.StatusOK {
+			t.Fatalf("request %d: expected status 200 got %d", i+1, rr.Code)
+		}
+	}
+	rr, _ := postValidate(t, r, ValidateRequest{CouponCode: "FIFTYOFF"})
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429 got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected Retry-After header")
+	}
+}
+
+func TestValidateCoupon_LocksOutGuessing(t *testing.T) {
+	r := NewRouter(&Handler{
+		Coupons:  index.NewMemoryIndexFromCodes("FIFTYOFF"),
+		Failures: ratelimit.NewFailureTracker(2, time.Minute, time.Hour),
+	})
+
+	for _, code := range []string{"FIFTYOFF", "GUESS001", "FIFTYOFF", "GUESS002"} {
+		if rr, _ := postValidate(t, r, ValidateRequest{CouponCode: code}); rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200 got %d", code, rr.Code)
+		}
+	}
+	if rr, _ := postValidate(t, r, ValidateRequest{CouponCode: "FIFTYOFF"}); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429 once locked out got %d", rr.Code)
+	}
+}
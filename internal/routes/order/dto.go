@@ -1,20 +1,42 @@
 package order
 
-import "github.com/PerumallaGiridhar/oolio/internal/data"
+import (
+	"time"
 
+	"github.com/PerumallaGiridhar/oolio/internal/data"
+)
+
+// OrderItem quantities and the number of items are capped so that, with
+// product prices capped too, line totals and the subtotal stay far from
+// overflowing data.Money.
 type OrderItem struct {
 	ProductID string `json:"productId" validate:"required"`
-	Quantity  int    `json:"quantity" validate:"required,min=1"`
+	Quantity  int    `json:"quantity" validate:"required,min=1,max=1000"`
 }
 
 type OrderRequest struct {
 	CouponCode string      `json:"couponCode" validate:"omitempty,promocode"`
-	Items      []OrderItem `json:"items" validate:"required,dive,required"`
+	CustomerID string      `json:"customerId,omitempty" validate:"omitempty,alphanum,max=64"`
+	Items      []OrderItem `json:"items" validate:"required,max=100,dive,required"`
+}
+
+type OrderLine struct {
+	ProductID string     `json:"productId"`
+	Quantity  int        `json:"quantity"`
+	UnitPrice data.Money `json:"unitPrice"`
+	LineTotal data.Money `json:"lineTotal"`
 }
 
 type OrderResponse struct {
 	ID         string         `json:"id"`
 	CouponCode string         `json:"couponCode"`
+	CustomerID string         `json:"customerId,omitempty"`
 	Items      []OrderItem    `json:"items"`
 	Products   []data.Product `json:"products"`
+	Lines      []OrderLine    `json:"lines"`
+	Subtotal   data.Money     `json:"subtotal"`
+	Discount   data.Money     `json:"discount"`
+	Tax        data.Money     `json:"tax"`
+	Total      data.Money     `json:"total"`
+	CreatedAt  time.Time      `json:"createdAt"`
 }
@@ -1,22 +1,81 @@
 package order
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/PerumallaGiridhar/oolio/internal/binding"
 	"github.com/PerumallaGiridhar/oolio/internal/data"
+	"github.com/PerumallaGiridhar/oolio/internal/index"
+	"github.com/PerumallaGiridhar/oolio/internal/promo"
+	"github.com/PerumallaGiridhar/oolio/internal/ratelimit"
 	"github.com/PerumallaGiridhar/oolio/internal/response"
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 )
 
-func CreateOrderRequest(w http.ResponseWriter, r *http.Request) {
+type Handler struct {
+	Orders Repository
+	// Products prices the ordered items.
+	Products data.ProductRepository
+	// Coupons is looked up once per order to reject unknown coupons and
+	// coupons outside their validity window. Nil means coupons are only
+	// checked for format by the request validator.
+	Coupons index.PromoIndex
+	// Rules turns a validated coupon into a discount. Nil means coupons
+	// give no discount.
+	Rules *promo.Engine
+	// Ledger records coupon redemptions and enforces usage limits. Nil
+	// means coupons can be used without limit.
+	Ledger *promo.Ledger
+	// Failures counts rejected coupons per client and locks out clients
+	// that keep guessing. Nil disables lockouts.
+	Failures *ratelimit.FailureTracker
+	// Policy normalizes coupon codes before rules are matched and
+	// redemptions recorded, so "happy-hrs" counts against HAPPYHRS.
+	Policy index.Policy
+	// PromosReady reports whether the promo index has loaded. Until it
+	// does, order creation answers 503 with Retry-After. Nil means the
+	// index is always loaded.
+	PromosReady func() bool
+	// TaxRateBPS is the tax rate applied to the discounted subtotal, in basis points.
+	TaxRateBPS int
+}
+
+func (h *Handler) CreateOrderRequest(w http.ResponseWriter, r *http.Request) {
 	var req OrderRequest
 	if err := binding.BindAndValidateJSONRequest(r, &req); err != nil {
+		if _, ok := err["CouponCode"]; ok && h.Failures != nil {
+			h.Failures.Fail(r)
+		}
 		response.JSONValidationErrorResponse(w, err)
 		return
 	}
 
+	if code, ok := h.Policy.Normalize(req.CouponCode); ok {
+		req.CouponCode = code
+	}
+
+	now := time.Now().UTC()
+	if req.CouponCode != "" && h.Coupons != nil {
+		err := promo.CheckCoupon(r.Context(), h.Coupons, req.CouponCode, now)
+		switch {
+		case errors.Is(err, promo.ErrCouponInvalid), errors.Is(err, promo.ErrCouponExpired), errors.Is(err, promo.ErrCouponNotActive):
+			if h.Failures != nil {
+				h.Failures.Fail(r)
+			}
+			response.JSONValidationErrorResponse(w, map[string]string{"couponCode": err.Error()})
+			return
+		case err != nil:
+			log.Printf("checking coupon %q: %v", req.CouponCode, err)
+			response.JSONErrorResponse(w, http.StatusServiceUnavailable, "promo service unavailable")
+			return
+		}
+	}
+
 	var products []data.Product
 	for _, item := range req.Items {
 		_, err := strconv.Atoi(item.ProductID)
@@ -25,20 +84,97 @@ func CreateOrderRequest(w http.ResponseWriter, r *http.Request) {
 			response.JSONValidationErrorResponse(w, errorMsg)
 			return
 		}
-		product, found := data.GetProductByID(item.ProductID)
-		if found {
-			products = append(products, product)
-		} else {
+		product, err := h.Products.Get(item.ProductID)
+		if errors.Is(err, data.ErrProductNotFound) {
 			response.JSONErrorResponse(w, http.StatusBadRequest, "ProductId does not exists")
 			return
 		}
+		if err != nil {
+			log.Printf("loading product %s: %v", item.ProductID, err)
+			response.JSONErrorResponse(w, http.StatusInternalServerError, "failed to load product")
+			return
+		}
+		products = append(products, product)
 	}
 
 	respData := OrderResponse{
 		ID:         uuid.New().String(),
 		CouponCode: req.CouponCode,
+		CustomerID: req.CustomerID,
 		Items:      req.Items,
 		Products:   products,
+		Lines:      priceLines(req.Items, products),
+		CreatedAt:  now,
+	}
+	var (
+		discount data.Money
+		limits   promo.Limits
+	)
+	if req.CouponCode != "" && h.Rules != nil {
+		if rule, ok := h.Rules.Match(req.CouponCode); ok {
+			discount = rule.Discount(promoLines(respData.Lines, products))
+			limits = rule.Limits()
+		}
+	}
+	applyTotals(&respData, discount, h.TaxRateBPS)
+
+	redeemed := false
+	if req.CouponCode != "" && h.Ledger != nil {
+		err := h.Ledger.Redeem(promo.Redemption{
+			Code:       req.CouponCode,
+			OrderID:    respData.ID,
+			CustomerID: req.CustomerID,
+			RedeemedAt: respData.CreatedAt,
+		}, limits)
+		switch {
+		case errors.Is(err, promo.ErrUsageLimitReached):
+			response.JSONErrorResponse(w, http.StatusConflict, err.Error())
+			return
+		case errors.Is(err, promo.ErrCustomerRequired):
+			response.JSONValidationErrorResponse(w, map[string]string{"customerId": "customerId is required for this coupon"})
+			return
+		case errors.Is(err, promo.ErrKeySeparator):
+			response.JSONValidationErrorResponse(w, map[string]string{"couponCode": "couponCode must not contain '/'"})
+			return
+		case err != nil:
+			log.Printf("redeeming coupon for order %s: %v", respData.ID, err)
+			response.JSONErrorResponse(w, http.StatusInternalServerError, "failed to redeem coupon")
+			return
+		}
+		redeemed = true
+	}
+
+	if err := h.Orders.Create(respData); err != nil {
+		log.Printf("saving order %s: %v", respData.ID, err)
+		if redeemed {
+			if err := h.Ledger.Release(req.CouponCode, respData.ID); err != nil {
+				log.Printf("releasing coupon for order %s: %v", respData.ID, err)
+			}
+		}
+		response.JSONErrorResponse(w, http.StatusInternalServerError, "failed to save order")
+		return
 	}
 	response.JSONResponse(w, http.StatusOK, respData)
 }
+
+func (h *Handler) FindOrderById(w http.ResponseWriter, r *http.Request) {
+	orderIdParam := chi.URLParam(r, "orderId")
+	if _, err := uuid.Parse(orderIdParam); err != nil {
+		errorMsg := map[string]string{"error": "invalid order Id, Id must be a UUID"}
+		response.JSONValidationErrorResponse(w, errorMsg)
+		return
+	}
+
+	order, err := h.Orders.Get(orderIdParam)
+	if errors.Is(err, ErrOrderNotFound) {
+		response.JSONErrorResponse(w, http.StatusNotFound, "order not found")
+		return
+	}
+	if err != nil {
+		log.Printf("loading order %s: %v", orderIdParam, err)
+		response.JSONErrorResponse(w, http.StatusInternalServerError, "failed to load order")
+		return
+	}
+
+	response.JSONResponse(w, http.StatusOK, order)
+}
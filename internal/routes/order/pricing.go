@@ -0,0 +1,59 @@
+package order
+
+import (
+	"github.com/PerumallaGiridhar/oolio/internal/data"
+	"github.com/PerumallaGiridhar/oolio/internal/promo"
+)
+
+// priceLines multiplies each item's quantity by the matching product price.
+// items and products are parallel slices, as built by CreateOrderRequest.
+func priceLines(items []OrderItem, products []data.Product) []OrderLine {
+	lines := make([]OrderLine, len(items))
+	for i, item := range items {
+		lines[i] = OrderLine{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			UnitPrice: products[i].Price,
+			LineTotal: products[i].Price.Times(item.Quantity),
+		}
+	}
+	return lines
+}
+
+// promoLines converts priced order lines into the shape the promo rules use.
+func promoLines(lines []OrderLine, products []data.Product) []promo.Line {
+	out := make([]promo.Line, len(lines))
+	for i, line := range lines {
+		out[i] = promo.Line{
+			ProductID: line.ProductID,
+			Category:  products[i].Category,
+			UnitPrice: line.UnitPrice,
+			Quantity:  line.Quantity,
+		}
+	}
+	return out
+}
+
+// applyTotals fills in the subtotal, discount, tax and grand total of order.
+// The discount is capped at the subtotal and tax is charged on the
+// discounted amount, rounded half up to the nearest cent.
+func applyTotals(order *OrderResponse, discount data.Money, taxRateBPS int) {
+	var subtotal data.Money
+	for _, line := range order.Lines {
+		subtotal += line.LineTotal
+	}
+	if discount > subtotal {
+		discount = subtotal
+	}
+	if discount < 0 {
+		discount = 0
+	}
+
+	taxable := subtotal - discount
+	tax := taxable.BasisPoints(taxRateBPS)
+
+	order.Subtotal = subtotal
+	order.Discount = discount
+	order.Tax = tax
+	order.Total = taxable + tax
+}
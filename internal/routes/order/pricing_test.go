@@ -0,0 +1,37 @@
+package order
+
+import (
+	"testing"
+
+	"github.com/PerumallaGiridhar/oolio/internal/data"
+)
+
+func TestApplyTotals(t *testing.T) {
+	items := []OrderItem{{ProductID: "1", Quantity: 2}, {ProductID: "4", Quantity: 3}}
+	products := []data.Product{{ID: "1", Price: 650}, {ID: "4", Price: 550}}
+
+	order := OrderResponse{Lines: priceLines(items, products)}
+	if order.Lines[0].LineTotal != 1300 || order.Lines[1].LineTotal != 1650 {
+		t.Fatalf("unexpected line totals: %+v", order.Lines)
+	}
+
+	applyTotals(&order, 300, 825)
+	if order.Subtotal != 2950 {
+		t.Errorf("Subtotal = %d, want 2950", order.Subtotal)
+	}
+	if order.Discount != 300 {
+		t.Errorf("Discount = %d, want 300", order.Discount)
+	}
+	// 26.50 * 8.25% = 2.18625 -> 2.19
+	if order.Tax != 219 {
+		t.Errorf("Tax = %d, want 219", order.Tax)
+	}
+	if order.Total != 2869 {
+		t.Errorf("Total = %d, want 2869", order.Total)
+	}
+
+	applyTotals(&order, 10000, 0)
+	if order.Discount != order.Subtotal || order.Total != 0 {
+		t.Errorf("expected discount capped at subtotal, got %+v", order)
+	}
+}
@@ -0,0 +1,78 @@
+package order
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/PerumallaGiridhar/oolio/internal/index"
+	"github.com/cockroachdb/pebble"
+)
+
+var ErrOrderNotFound = errors.New("order not found")
+
+type Repository interface {
+	Create(order OrderResponse) error
+	Get(id string) (OrderResponse, error)
+	List() ([]OrderResponse, error)
+}
+
+// PebbleRepository stores orders as JSON under the "order/" key prefix.
+type PebbleRepository struct {
+	db *pebble.DB
+}
+
+const orderKeyPrefix = "order/"
+
+func NewPebbleRepository(db *pebble.DB) *PebbleRepository {
+	return &PebbleRepository{db: db}
+}
+
+func orderKey(id string) []byte {
+	return []byte(orderKeyPrefix + id)
+}
+
+func (r *PebbleRepository) Create(order OrderResponse) error {
+	value, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+	return r.db.Set(orderKey(order.ID), value, pebble.Sync)
+}
+
+func (r *PebbleRepository) Get(id string) (OrderResponse, error) {
+	value, closer, err := r.db.Get(orderKey(id))
+	if errors.Is(err, pebble.ErrNotFound) {
+		return OrderResponse{}, ErrOrderNotFound
+	}
+	if err != nil {
+		return OrderResponse{}, err
+	}
+	defer closer.Close()
+
+	var order OrderResponse
+	if err := json.Unmarshal(value, &order); err != nil {
+		return OrderResponse{}, err
+	}
+	return order, nil
+}
+
+func (r *PebbleRepository) List() ([]OrderResponse, error) {
+	iter, err := r.db.NewIter(&pebble.IterOptions{
+		LowerBound: []byte(orderKeyPrefix),
+		UpperBound: index.PrefixUpperBound(orderKeyPrefix),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	orders := []OrderResponse{}
+	for iter.First(); iter.Valid(); iter.Next() {
+		var order OrderResponse
+		if err := json.Unmarshal(iter.Value(), &order); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, iter.Error()
+}
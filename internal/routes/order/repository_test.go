@@ -0,0 +1,41 @@
+package order
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPebbleRepository_CreateGetList(t *testing.T) {
+	repo := newTestRepository(t)
+
+	if _, err := repo.Get("missing"); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("Get(missing) error = %v, want ErrOrderNotFound", err)
+	}
+
+	orders := []OrderResponse{
+		{ID: "a", CouponCode: "HAPPYHRS", Items: []OrderItem{{ProductID: "1", Quantity: 2}}, CreatedAt: time.Now().UTC()},
+		{ID: "b", Items: []OrderItem{{ProductID: "3", Quantity: 1}}, CreatedAt: time.Now().UTC()},
+	}
+	for _, o := range orders {
+		if err := repo.Create(o); err != nil {
+			t.Fatalf("Create(%s) error: %v", o.ID, err)
+		}
+	}
+
+	got, err := repo.Get("a")
+	if err != nil {
+		t.Fatalf("Get(a) error: %v", err)
+	}
+	if got.CouponCode != "HAPPYHRS" || len(got.Items) != 1 || got.Items[0].Quantity != 2 {
+		t.Errorf("Get(a) = %+v, want stored order", got)
+	}
+
+	list, err := repo.List()
+	if err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	if len(list) != 2 || list[0].ID != "a" || list[1].ID != "b" {
+		t.Errorf("List = %+v, want orders a and b", list)
+	}
+}
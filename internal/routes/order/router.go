@@ -2,12 +2,37 @@ package order
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/PerumallaGiridhar/oolio/internal/response"
 	"github.com/go-chi/chi/v5"
 )
 
-func NewRouter() http.Handler {
+// loadingRetryAfter is how long clients are asked to wait while the promo
+// index loads.
+const loadingRetryAfter = 10 * time.Second
+
+func NewRouter(h *Handler) http.Handler {
 	r := chi.NewRouter()
-	r.Post("/", CreateOrderRequest)
+	create := r.With(h.requirePromos)
+	if h.Failures != nil {
+		create = create.With(h.Failures.Middleware)
+	}
+	create.Post("/", h.CreateOrderRequest)
+	r.Get("/{orderId}", h.FindOrderById)
 	return r
 }
+
+// requirePromos refuses requests with 503 until the promo index has loaded,
+// so no order is placed without its coupon being checked.
+func (h *Handler) requirePromos(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.PromosReady != nil && !h.PromosReady() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(loadingRetryAfter.Seconds())))
+			response.JSONErrorResponse(w, http.StatusServiceUnavailable, "promo index is loading")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -2,18 +2,30 @@ package order
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	enlocales "github.com/go-playground/locales/en"
 	ut "github.com/go-playground/universal-translator"
 	v10 "github.com/go-playground/validator/v10"
 	enTranslations "github.com/go-playground/validator/v10/translations/en"
 
+	"github.com/PerumallaGiridhar/oolio/internal/data"
+	"github.com/PerumallaGiridhar/oolio/internal/index"
+	"github.com/PerumallaGiridhar/oolio/internal/promo"
+	"github.com/PerumallaGiridhar/oolio/internal/ratelimit"
 	"github.com/PerumallaGiridhar/oolio/internal/validation"
+	"github.com/google/uuid"
 )
 
 func init() {
@@ -27,14 +39,28 @@ func init() {
 	})
 }
 
+var testProducts = data.NewMemoryProductRepository(data.DefaultProducts())
+
+func newTestRepository(t *testing.T) *PebbleRepository {
+	t.Helper()
+	db, err := index.OpenPebble(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to open pebble: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewPebbleRepository(db)
+}
+
 func TestCreateOrder_SuccessAndValidationError(t *testing.T) {
-	r := NewRouter()
+	repo := newTestRepository(t)
+	r := NewRouter(&Handler{Orders: repo, Products: testProducts})
 
 	type tc struct {
-		name      string
-		productId string
-		quantity  int
-		reqStatus int
+		name       string
+		productId  string
+		quantity   int
+		customerId string
+		reqStatus  int
 	}
 
 	cases := []tc{
@@ -62,12 +88,39 @@ func TestCreateOrder_SuccessAndValidationError(t *testing.T) {
 			quantity:  0,
 			reqStatus: http.StatusUnprocessableEntity,
 		},
+		{
+			name:      "largest quantity",
+			productId: "5",
+			quantity:  1000,
+			reqStatus: http.StatusOK,
+		},
+		{
+			name:      "quantity too large",
+			productId: "5",
+			quantity:  1001,
+			reqStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "customer id",
+			productId:  "5",
+			quantity:   1,
+			customerId: "alice42",
+			reqStatus:  http.StatusOK,
+		},
+		{
+			name:       "customer id with separator",
+			productId:  "5",
+			quantity:   1,
+			customerId: "alice/42",
+			reqStatus:  http.StatusUnprocessableEntity,
+		},
 	}
 
 	for _, testCase := range cases {
 		t.Run(testCase.name, func(t *testing.T) {
 			payload := OrderRequest{
 				CouponCode: "FIFTYOFF",
+				CustomerID: testCase.customerId,
 				Items: []OrderItem{
 					{
 						ProductID: testCase.productId,
@@ -93,8 +146,315 @@ func TestCreateOrder_SuccessAndValidationError(t *testing.T) {
 				if !reflect.DeepEqual(res.Items, payload.Items) {
 					t.Fatalf("response items does not match items in order request")
 				}
+				if res.Subtotal != 6500 || res.Total != 6500 {
+					t.Fatalf("expected subtotal and total 65.00, got %s and %s", res.Subtotal, res.Total)
+				}
+				stored, err := repo.Get(res.ID)
+				if err != nil {
+					t.Fatalf("expected order %s to be persisted: %v", res.ID, err)
+				}
+				if !reflect.DeepEqual(stored.Items, payload.Items) {
+					t.Fatalf("stored items does not match items in order request")
+				}
 			}
 		})
 
 	}
 }
+
+func TestFindOrderById_SuccessInvalidAndNotFound(t *testing.T) {
+	repo := newTestRepository(t)
+	r := NewRouter(&Handler{Orders: repo, Products: testProducts})
+
+	payload := OrderRequest{Items: []OrderItem{{ProductID: "1", Quantity: 2}}}
+	b, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 creating order got %d", rr.Code)
+	}
+	var created OrderResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Invalid json response from create order")
+	}
+
+	// existing id
+	req = httptest.NewRequest(http.MethodGet, "/"+created.ID, nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d", rr.Code)
+	}
+	var found OrderResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &found); err != nil {
+		t.Fatalf("failed to unmarshal order: %v", err)
+	}
+	if found.ID != created.ID || !reflect.DeepEqual(found.Items, created.Items) {
+		t.Fatalf("expected stored order %+v got %+v", created, found)
+	}
+
+	// non-existing id
+	req = httptest.NewRequest(http.MethodGet, "/7f1b6a9e-6f6e-4c39-9a57-3f0b8d1f2c11", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 got %d", rr.Code)
+	}
+
+	// invalid id
+	req = httptest.NewRequest(http.MethodGet, "/not-a-uuid", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422 got %d", rr.Code)
+	}
+}
+
+func TestCreateOrder_AppliesPromoRule(t *testing.T) {
+	rulesPath := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(rulesPath, []byte(`{"rules":[{"code":"FIFTYOFF","type":"percentage","percent":50}]}`), 0o644); err != nil {
+		t.Fatalf("failed to write rules file: %v", err)
+	}
+	rules, err := promo.NewEngine(rulesPath, index.Policy{})
+	if err != nil {
+		t.Fatalf("NewEngine error: %v", err)
+	}
+	r := NewRouter(&Handler{Orders: newTestRepository(t), Products: testProducts, Rules: rules, TaxRateBPS: 1000})
+
+	payload := OrderRequest{
+		CouponCode: "FIFTYOFF",
+		Items:      []OrderItem{{ProductID: "1", Quantity: 2}},
+	}
+	b, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d", rr.Code)
+	}
+
+	var res OrderResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatalf("Invalid json response from create order")
+	}
+	// 2 x 6.50 = 13.00, 50% off = 6.50, 10% tax = 0.65
+	if res.Subtotal != 1300 || res.Discount != 650 || res.Tax != 65 || res.Total != 715 {
+		t.Fatalf("unexpected totals: subtotal=%s discount=%s tax=%s total=%s", res.Subtotal, res.Discount, res.Tax, res.Total)
+	}
+}
+
+type failingRepository struct{ Repository }
+
+func (failingRepository) Create(OrderResponse) error { return errors.New("disk full") }
+
+func TestCreateOrder_EnforcesCouponLimits(t *testing.T) {
+	rulesPath := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(rulesPath, []byte(`{"rules":[{"code":"ONCE0001","type":"fixed","amount":1.00,"maxUses":1}]}`), 0o644); err != nil {
+		t.Fatalf("failed to write rules file: %v", err)
+	}
+	rules, err := promo.NewEngine(rulesPath, index.Policy{})
+	if err != nil {
+		t.Fatalf("NewEngine error: %v", err)
+	}
+	repo := newTestRepository(t)
+	ledger := promo.NewLedger(repo.db, index.Policy{})
+
+	post := func(h *Handler, code string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(OrderRequest{CouponCode: code, Items: []OrderItem{{ProductID: "1", Quantity: 1}}})
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		NewRouter(h).ServeHTTP(rr, req)
+		return rr
+	}
+
+	// A failed save must give the use back.
+	if rr := post(&Handler{Orders: failingRepository{}, Products: testProducts, Rules: rules, Ledger: ledger}, "ONCE0001"); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500 for failed save got %d", rr.Code)
+	}
+	if uses, _ := ledger.Uses("ONCE0001"); uses != 0 {
+		t.Fatalf("expected failed order to release the coupon, uses = %d", uses)
+	}
+
+	h := &Handler{Orders: repo, Products: testProducts, Rules: rules, Ledger: ledger, Policy: index.Policy{Strip: "-"}}
+	rr := post(h, "ONCE0001")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d", rr.Code)
+	}
+	var created OrderResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &created)
+	redemptions, _ := ledger.Redemptions("ONCE0001")
+	if len(redemptions) != 1 || redemptions[0].OrderID != created.ID {
+		t.Fatalf("expected redemption for order %s, got %+v", created.ID, redemptions)
+	}
+
+	if rr := post(h, "ONCE0001"); rr.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 for reused single-use coupon got %d", rr.Code)
+	}
+	// Spelling the code differently must not get around the limit.
+	if rr := post(h, "once-0001"); rr.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 for reused coupon spelled differently got %d", rr.Code)
+	}
+}
+
+func TestCreateOrder_RejectsCouponOutsideWindow(t *testing.T) {
+	now := time.Now()
+	coupons := index.NewMemoryIndexFromCodes("ACTIVE01")
+	coupons.Add("EXPIRED1", index.Window{EndsAt: now.Add(-time.Hour)})
+	coupons.Add("UPCOMING", index.Window{StartsAt: now.Add(time.Hour)})
+	r := NewRouter(&Handler{Orders: newTestRepository(t), Products: testProducts, Coupons: coupons})
+
+	cases := map[string]struct {
+		status int
+		msg    string
+	}{
+		"ACTIVE01": {http.StatusOK, ""},
+		"EXPIRED1": {http.StatusUnprocessableEntity, "coupon expired"},
+		"UPCOMING": {http.StatusUnprocessableEntity, "coupon not yet active"},
+		"UNKNOWN1": {http.StatusUnprocessableEntity, "invalid coupon"},
+	}
+	for code, want := range cases {
+		b, _ := json.Marshal(OrderRequest{CouponCode: code, Items: []OrderItem{{ProductID: "1", Quantity: 1}}})
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != want.status {
+			t.Fatalf("%s: expected status %d got %d", code, want.status, rr.Code)
+		}
+		if want.msg == "" {
+			continue
+		}
+		var body struct {
+			Fields map[string]string `json:"fields"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &body)
+		if body.Fields["couponCode"] != want.msg {
+			t.Errorf("%s: expected couponCode error %q, got body %s", code, want.msg, rr.Body.String())
+		}
+	}
+}
+
+// countingIndex counts the lookups made against a promo index.
+type countingIndex struct {
+	index.PromoIndex
+	lookups atomic.Int64
+}
+
+func (c *countingIndex) Lookup(ctx context.Context, code string, at time.Time) (index.Status, error) {
+	c.lookups.Add(1)
+	return c.PromoIndex.Lookup(ctx, code, at)
+}
+
+func TestCreateOrder_LooksUpCouponOnce(t *testing.T) {
+	coupons := &countingIndex{PromoIndex: index.NewMemoryIndexFromCodes("ACTIVE01")}
+	r := NewRouter(&Handler{Orders: newTestRepository(t), Products: testProducts, Coupons: coupons})
+
+	for code, status := range map[string]int{"ACTIVE01": http.StatusOK, "UNKNOWN1": http.StatusUnprocessableEntity} {
+		coupons.lookups.Store(0)
+		b, _ := json.Marshal(OrderRequest{CouponCode: code, Items: []OrderItem{{ProductID: "1", Quantity: 1}}})
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != status {
+			t.Fatalf("%s: expected status %d got %d", code, status, rr.Code)
+		}
+		if n := coupons.lookups.Load(); n != 1 {
+			t.Errorf("%s: expected one promo lookup per order, got %d", code, n)
+		}
+	}
+}
+
+type unavailableIndex struct{ index.PromoIndex }
+
+func (unavailableIndex) Lookup(context.Context, string, time.Time) (index.Status, error) {
+	return index.StatusInvalid, index.ErrUnavailable
+}
+
+func TestCreateOrder_PromoServiceUnavailable(t *testing.T) {
+	r := NewRouter(&Handler{Orders: newTestRepository(t), Products: testProducts, Coupons: unavailableIndex{}})
+
+	b, _ := json.Marshal(OrderRequest{CouponCode: "ACTIVE01", Items: []OrderItem{{ProductID: "1", Quantity: 1}}})
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503 got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "promo service unavailable") {
+		t.Errorf("unexpected body %s", rr.Body.String())
+	}
+}
+
+func TestCreateOrder_WaitsForPromoIndex(t *testing.T) {
+	ready := false
+	r := NewRouter(&Handler{Orders: newTestRepository(t), Products: testProducts, PromosReady: func() bool { return ready }})
+
+	post := func() *httptest.ResponseRecorder {
+		b, _ := json.Marshal(OrderRequest{Items: []OrderItem{{ProductID: "1", Quantity: 1}}})
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := post()
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503 while loading got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "10" {
+		t.Errorf("Retry-After = %q, want 10", rr.Header().Get("Retry-After"))
+	}
+	// Reading orders does not need the promo index.
+	req := httptest.NewRequest(http.MethodGet, "/"+uuid.NewString(), nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown order while loading got %d", rr.Code)
+	}
+
+	ready = true
+	if rr := post(); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 once loaded got %d", rr.Code)
+	}
+}
+
+func TestCreateOrder_LocksOutCouponGuessing(t *testing.T) {
+	r := NewRouter(&Handler{
+		Orders:   newTestRepository(t),
+		Products: testProducts,
+		Coupons:  index.NewMemoryIndexFromCodes("ACTIVE01"),
+		Failures: ratelimit.NewFailureTracker(2, time.Minute, time.Hour),
+	})
+
+	post := func(code string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(OrderRequest{CouponCode: code, Items: []OrderItem{{ProductID: "1", Quantity: 1}}})
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post("ACTIVE01"); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d", rr.Code)
+	}
+	for _, code := range []string{"GUESS001", "GUESS002"} {
+		if rr := post(code); rr.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("%s: expected status 422 got %d", code, rr.Code)
+		}
+	}
+	rr := post("ACTIVE01")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429 once locked out got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "60" {
+		t.Errorf("Retry-After = %q, want 60", rr.Header().Get("Retry-After"))
+	}
+}
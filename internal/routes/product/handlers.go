@@ -1,34 +1,189 @@
 package product
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 
+	"github.com/PerumallaGiridhar/oolio/internal/binding"
 	"github.com/PerumallaGiridhar/oolio/internal/data"
 	"github.com/PerumallaGiridhar/oolio/internal/response"
 	"github.com/go-chi/chi/v5"
 )
 
-func ListProducts(w http.ResponseWriter, r *http.Request) {
-	products := data.GetAllProducts()
+type Handler struct {
+	Products data.ProductRepository
+	// AdminKey is the bearer token required to create, update and delete
+	// products. Empty disables those endpoints.
+	AdminKey string
+}
+
+func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request) {
+	products, err := h.Products.List()
+	if err != nil {
+		log.Printf("listing products: %v", err)
+		response.JSONErrorResponse(w, http.StatusInternalServerError, "failed to load products")
+		return
+	}
 	response.JSONResponse(w, http.StatusOK, products)
 }
 
-func FindProductById(w http.ResponseWriter, r *http.Request) {
-	productIdParam := chi.URLParam(r, "productId")
-	_, err := strconv.Atoi(productIdParam)
+// ExportProducts downloads the catalog as a file PRODUCTS_FILE can load,
+// in the format named by the "format" query parameter (json by default).
+func (h *Handler) ExportProducts(w http.ResponseWriter, r *http.Request) {
+	format := data.CatalogJSON
+	if param := r.URL.Query().Get("format"); param != "" {
+		var err error
+		if format, err = data.ParseCatalogFormat(param); err != nil {
+			errorMsg := map[string]string{"error": "invalid format, format must be json or csv"}
+			response.JSONValidationErrorResponse(w, errorMsg)
+			return
+		}
+	}
+
+	products, err := h.Products.List()
 	if err != nil {
+		log.Printf("listing products: %v", err)
+		response.JSONErrorResponse(w, http.StatusInternalServerError, "failed to load products")
+		return
+	}
+
+	contentType := "application/json"
+	if format == data.CatalogCSV {
+		contentType = "text/csv; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="products.`+string(format)+`"`)
+	if err := data.WriteCatalog(w, format, products); err != nil {
+		log.Printf("exporting products: %v", err)
+	}
+}
+
+// productID reads the product Id from the URL, answering 422 when it is
+// not an integer.
+func productID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	productIdParam := chi.URLParam(r, "productId")
+	if _, err := strconv.Atoi(productIdParam); err != nil {
 		errorMsg := map[string]string{"error": "invalid product Id, Id must be an integer"}
 		response.JSONValidationErrorResponse(w, errorMsg)
-		return
+		return "", false
 	}
+	return productIdParam, true
+}
 
-	product, found := data.GetProductByID(productIdParam)
-	if !found {
+// loadProduct gets a product, answering 404 or 500 when it cannot.
+func (h *Handler) loadProduct(w http.ResponseWriter, id string) (data.Product, bool) {
+	product, err := h.Products.Get(id)
+	if errors.Is(err, data.ErrProductNotFound) {
 		response.JSONErrorResponse(w, http.StatusNotFound, "product not found")
+		return data.Product{}, false
+	}
+	if err != nil {
+		log.Printf("loading product %s: %v", id, err)
+		response.JSONErrorResponse(w, http.StatusInternalServerError, "failed to load product")
+		return data.Product{}, false
+	}
+	return product, true
+}
+
+func (h *Handler) FindProductById(w http.ResponseWriter, r *http.Request) {
+	id, ok := productID(w, r)
+	if !ok {
 		return
 	}
+	product, ok := h.loadProduct(w, id)
+	if !ok {
+		return
+	}
+	response.JSONResponse(w, http.StatusOK, product)
+}
 
+func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
+	var product data.Product
+	if err := binding.BindAndValidateJSONRequest(r, &product); err != nil {
+		response.JSONValidationErrorResponse(w, err)
+		return
+	}
+
+	err := h.Products.Create(product)
+	if errors.Is(err, data.ErrProductExists) {
+		response.JSONErrorResponse(w, http.StatusConflict, "product already exists")
+		return
+	}
+	if err != nil {
+		log.Printf("creating product %s: %v", product.ID, err)
+		response.JSONErrorResponse(w, http.StatusInternalServerError, "failed to save product")
+		return
+	}
+	response.JSONResponse(w, http.StatusCreated, product)
+}
+
+// UpdateProduct replaces a product. The body may leave out the Id.
+func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	id, ok := productID(w, r)
+	if !ok {
+		return
+	}
+	h.saveProduct(w, r, data.Product{ID: id})
+}
+
+// PatchProduct changes only the fields given in the body, including single
+// fields of the image.
+func (h *Handler) PatchProduct(w http.ResponseWriter, r *http.Request) {
+	id, ok := productID(w, r)
+	if !ok {
+		return
+	}
+	product, ok := h.loadProduct(w, id)
+	if !ok {
+		return
+	}
+	h.saveProduct(w, r, product)
+}
+
+// saveProduct decodes the body over product and stores the result as an
+// update. Decoding leaves fields missing from the body as they were.
+func (h *Handler) saveProduct(w http.ResponseWriter, r *http.Request, product data.Product) {
+	id := product.ID
+	if err := binding.BindAndValidateJSONRequest(r, &product); err != nil {
+		response.JSONValidationErrorResponse(w, err)
+		return
+	}
+	if product.ID != id {
+		errorMsg := map[string]string{"error": "product Id does not match the URL"}
+		response.JSONValidationErrorResponse(w, errorMsg)
+		return
+	}
+
+	err := h.Products.Update(product)
+	if errors.Is(err, data.ErrProductNotFound) {
+		response.JSONErrorResponse(w, http.StatusNotFound, "product not found")
+		return
+	}
+	if err != nil {
+		log.Printf("updating product %s: %v", id, err)
+		response.JSONErrorResponse(w, http.StatusInternalServerError, "failed to save product")
+		return
+	}
 	response.JSONResponse(w, http.StatusOK, product)
+}
 
+func (h *Handler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	id, ok := productID(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.Products.Delete(id)
+	if errors.Is(err, data.ErrProductNotFound) {
+		response.JSONErrorResponse(w, http.StatusNotFound, "product not found")
+		return
+	}
+	if err != nil {
+		log.Printf("deleting product %s: %v", id, err)
+		response.JSONErrorResponse(w, http.StatusInternalServerError, "failed to delete product")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -1,14 +1,38 @@
 package product
 
 import (
+	"crypto/subtle"
 	"net/http"
+	"strings"
 
+	"github.com/PerumallaGiridhar/oolio/internal/response"
 	"github.com/go-chi/chi/v5"
 )
 
-func NewRouter() http.Handler {
+func NewRouter(h *Handler) http.Handler {
 	r := chi.NewRouter()
-	r.Get("/", ListProducts)
-	r.Get("/{productId}", FindProductById)
+	r.Get("/", h.ListProducts)
+	r.Get("/export", h.ExportProducts)
+	r.Get("/{productId}", h.FindProductById)
+	if h.AdminKey != "" {
+		admin := r.With(h.requireAdmin)
+		admin.Post("/", h.CreateProduct)
+		admin.Put("/{productId}", h.UpdateProduct)
+		admin.Patch("/{productId}", h.PatchProduct)
+		admin.Delete("/{productId}", h.DeleteProduct)
+	}
 	return r
 }
+
+// requireAdmin refuses requests without "Authorization: Bearer <AdminKey>".
+func (h *Handler) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.AdminKey)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="products"`)
+			response.JSONErrorResponse(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
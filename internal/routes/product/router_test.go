@@ -1,9 +1,12 @@
 package product
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	enlocales "github.com/go-playground/locales/en"
@@ -27,7 +30,7 @@ func init() {
 }
 
 func TestListProducts(t *testing.T) {
-	r := NewRouter()
+	r := NewRouter(&Handler{Products: data.NewMemoryProductRepository(data.DefaultProducts())})
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	rr := httptest.NewRecorder()
 	r.ServeHTTP(rr, req)
@@ -46,7 +49,7 @@ func TestListProducts(t *testing.T) {
 }
 
 func TestFindProductById_SuccessInvalidAndNotFound(t *testing.T) {
-	r := NewRouter()
+	r := NewRouter(&Handler{Products: data.NewMemoryProductRepository(data.DefaultProducts())})
 
 	// existing id
 	req := httptest.NewRequest(http.MethodGet, "/1", nil)
@@ -79,3 +82,161 @@ func TestFindProductById_SuccessInvalidAndNotFound(t *testing.T) {
 		t.Fatalf("expected status 404 got %d", rr3.Code)
 	}
 }
+
+type failingRepository struct{ data.ProductRepository }
+
+func (failingRepository) List() ([]data.Product, error) { return nil, errors.New("disk failed") }
+
+func (failingRepository) Get(string) (data.Product, error) {
+	return data.Product{}, errors.New("disk failed")
+}
+
+func TestProducts_StoreErrors(t *testing.T) {
+	r := NewRouter(&Handler{Products: failingRepository{}})
+	for _, path := range []string{"/", "/1"} {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("GET %s: expected status 500 got %d", path, rr.Code)
+		}
+	}
+}
+
+func TestAdminProducts_CreateUpdateDelete(t *testing.T) {
+	r := NewRouter(&Handler{Products: data.NewMemoryProductRepository(data.DefaultProducts()), AdminKey: "s3cret"})
+	send := func(method, path, key string, body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	tart := map[string]any{
+		"id":       "10",
+		"name":     "Lemon Tart",
+		"category": "Tart",
+		"price":    5.25,
+		"image":    map[string]string{"thumbnail": "https://example.com/tart.jpg"},
+	}
+
+	for _, key := range []string{"", "wrong"} {
+		if rr := send(http.MethodPost, "/", key, tart); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("key %q: expected status 401 got %d", key, rr.Code)
+		}
+	}
+	if rr := send(http.MethodPost, "/", "s3cret", tart); rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201 got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := send(http.MethodPost, "/", "s3cret", tart); rr.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 for a taken id got %d", rr.Code)
+	}
+
+	var body struct {
+		Fields map[string]string `json:"fields"`
+	}
+	rr := send(http.MethodPost, "/", "s3cret", map[string]any{
+		"id": "11", "name": "", "category": "Tart", "price": 0,
+		"image": map[string]string{"mobile": "not a url"},
+	})
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422 for invalid fields got %d", rr.Code)
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &body)
+	for _, field := range []string{"Name", "Price", "Mobile"} {
+		if _, ok := body.Fields[field]; !ok {
+			t.Errorf("expected a validation error for %s, got %v", field, body.Fields)
+		}
+	}
+
+	// Prices above the cap, or too large to hold in cents, are refused on
+	// every write.
+	for _, price := range []json.Number{"1000000.01", "184467440737095517"} {
+		big := map[string]any{"id": "11", "name": "Gold Tart", "category": "Tart", "price": price}
+		if rr := send(http.MethodPost, "/", "s3cret", big); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("price %s: expected status 422 for POST got %d", price, rr.Code)
+		}
+		if rr := send(http.MethodPut, "/10", "s3cret", map[string]any{"name": "Gold Tart", "category": "Tart", "price": price}); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("price %s: expected status 422 for PUT got %d", price, rr.Code)
+		}
+		if rr := send(http.MethodPatch, "/10", "s3cret", map[string]any{"price": price}); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("price %s: expected status 422 for PATCH got %d", price, rr.Code)
+		}
+	}
+
+	// PUT replaces the whole product, so the image goes.
+	put := map[string]any{"name": "Lime Tart", "category": "Tart", "price": 5.5}
+	if rr := send(http.MethodPut, "/10", "s3cret", put); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for PUT got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := send(http.MethodPut, "/12", "s3cret", put); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for PUT of a missing product got %d", rr.Code)
+	}
+	if rr := send(http.MethodPut, "/10", "s3cret", map[string]any{"id": "12", "name": "x", "category": "x", "price": 1}); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422 for a mismatched id got %d", rr.Code)
+	}
+
+	// PATCH keeps the fields it is not given.
+	rr = send(http.MethodPatch, "/10", "s3cret", map[string]any{"price": 6, "image": map[string]string{"desktop": "https://example.com/tart-desktop.jpg"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for PATCH got %d: %s", rr.Code, rr.Body)
+	}
+	var p data.Product
+	_ = json.Unmarshal(rr.Body.Bytes(), &p)
+	if p.Name != "Lime Tart" || p.Price != 600 || p.Image.Desktop == "" || p.Image.Thumbnail != "" {
+		t.Errorf("PATCH returned %+v, want the patched Lime Tart", p)
+	}
+
+	if rr := send(http.MethodDelete, "/10", "s3cret", nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204 for DELETE got %d", rr.Code)
+	}
+	if rr := send(http.MethodGet, "/10", "", nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 after DELETE got %d", rr.Code)
+	}
+	if rr := send(http.MethodDelete, "/10", "s3cret", nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for a second DELETE got %d", rr.Code)
+	}
+}
+
+func TestAdminProducts_DisabledWithoutKey(t *testing.T) {
+	r := NewRouter(&Handler{Products: data.NewMemoryProductRepository(data.DefaultProducts())})
+	req := httptest.NewRequest(http.MethodDelete, "/1", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405 got %d", rr.Code)
+	}
+}
+
+func TestExportProducts(t *testing.T) {
+	r := NewRouter(&Handler{Products: data.NewMemoryProductRepository(data.DefaultProducts())})
+	for _, format := range []data.CatalogFormat{data.CatalogJSON, data.CatalogCSV} {
+		req := httptest.NewRequest(http.MethodGet, "/export?format="+string(format), nil)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200 got %d", format, rr.Code)
+		}
+		if got := rr.Header().Get("Content-Disposition"); !strings.Contains(got, "products."+string(format)) {
+			t.Errorf("%s: Content-Disposition = %q", format, got)
+		}
+		products, err := data.ReadCatalog(rr.Body, format)
+		if err != nil {
+			t.Fatalf("%s: export does not read back: %v", format, err)
+		}
+		if len(products) != len(data.DefaultProducts()) {
+			t.Errorf("%s: exported %d products, want %d", format, len(products), len(data.DefaultProducts()))
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/export?format=xml", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422 for an unknown format got %d", rr.Code)
+	}
+}
@@ -1,11 +1,14 @@
 package routes
 
 import (
+	"expvar"
 	"fmt"
 	"net/http"
 	"runtime"
 
+	"github.com/PerumallaGiridhar/oolio/internal/index"
 	"github.com/PerumallaGiridhar/oolio/internal/response"
+	"github.com/PerumallaGiridhar/oolio/internal/routes/coupon"
 	"github.com/PerumallaGiridhar/oolio/internal/routes/order"
 	"github.com/PerumallaGiridhar/oolio/internal/routes/product"
 	"github.com/go-chi/chi/v5"
@@ -26,7 +29,50 @@ func MemUsage(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func NewRouter() *chi.Mux {
+// Ready answers 200 once promos can serve lookups and 503 otherwise, with
+// the health of each store from the latest background probe when the index
+// can probe them. Unlike /live it tells the load balancer whether to route
+// traffic here.
+func Ready(promos index.PromoIndex) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		health := index.Health{Ready: promos != nil}
+		if checker, ok := promos.(index.HealthChecker); ok {
+			health = checker.LastHealth()
+		}
+		status := http.StatusOK
+		if !health.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		response.JSONResponse(w, status, health)
+	}
+}
+
+// Status reports whether the promo index has loaded and, while it loads,
+// how far its build has got.
+func Status(promos index.PromoIndex) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := index.LoadStatus{State: index.LoadLoading}
+		if promos != nil {
+			status = index.LoadStatus{State: index.LoadReady, Percent: 100}
+		}
+		if loader, ok := promos.(*index.Loader); ok {
+			status = loader.Status()
+		}
+		response.JSONResponse(w, http.StatusOK, status)
+	}
+}
+
+// NewDebugRouter serves the expvar counters at /debug/vars. They include
+// the command line and memory stats, so it is meant for an internal
+// listener and is never mounted on the public router.
+func NewDebugRouter() *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+	r.Handle("/debug/vars", expvar.Handler())
+	return r
+}
+
+func NewRouter(products *product.Handler, orders *order.Handler, coupons *coupon.Handler, promos index.PromoIndex) *chi.Mux {
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
@@ -34,17 +80,20 @@ func NewRouter() *chi.Mux {
 	r.Use(middleware.Heartbeat("/live"))
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
+	r.Get("/ready", Ready(promos))
+	r.Get("/status", Status(promos))
 	r.Get("/stats", MemUsage)
 	r.Route("/api", func(r chi.Router) {
 		r.Use(middleware.AllowContentType("application/json"))
-		r.Mount("/product", product.NewRouter())
-		r.Mount("/order", order.NewRouter())
+		r.Mount("/product", product.NewRouter(products))
+		r.Mount("/order", order.NewRouter(orders))
+		r.Mount("/promo", coupon.NewRouter(coupons))
 	})
 
 	return r
@@ -1,11 +1,19 @@
 package routes
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/PerumallaGiridhar/oolio/internal/index"
+	"github.com/PerumallaGiridhar/oolio/internal/routes/coupon"
+	"github.com/PerumallaGiridhar/oolio/internal/routes/order"
+	"github.com/PerumallaGiridhar/oolio/internal/routes/product"
 )
 
 func TestMemUsage_ReturnsStats(t *testing.T) {
@@ -36,7 +44,7 @@ func TestMemUsage_ReturnsStats(t *testing.T) {
 }
 
 func TestStatsEndpoint(t *testing.T) {
-	r := NewRouter()
+	r := NewRouter(&product.Handler{}, &order.Handler{}, &coupon.Handler{}, nil)
 	req := httptest.NewRequest(http.MethodGet, "/stats", nil)
 	rr := httptest.NewRecorder()
 	r.ServeHTTP(rr, req)
@@ -57,8 +65,77 @@ func TestStatsEndpoint(t *testing.T) {
 	}
 }
 
+func TestNewRouter_Ready(t *testing.T) {
+	get := func(promos index.PromoIndex) (int, index.Health) {
+		r := NewRouter(&product.Handler{}, &order.Handler{}, &coupon.Handler{}, promos)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		var h index.Health
+		if err := json.Unmarshal(rr.Body.Bytes(), &h); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		return rr.Code, h
+	}
+
+	if code, _ := get(nil); code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 without an index, got %d", code)
+	}
+	if code, h := get(index.NewMemoryIndexFromCodes("HAPPYHRS")); code != http.StatusOK || !h.Ready {
+		t.Errorf("expected memory index to be ready, got %d %+v", code, h)
+	}
+
+	path := filepath.Join(t.TempDir(), "codes.txt")
+	if err := os.WriteFile(path, []byte("HAPPYHRS\n"), 0o644); err != nil {
+		t.Fatalf("writing promo file: %v", err)
+	}
+	pi, err := index.NewPebbleIndex([]string{path}, index.Options{Quorum: 1})
+	if err != nil {
+		t.Fatalf("NewPebbleIndex error: %v", err)
+	}
+	if code, h := get(pi); code != http.StatusOK || h.Healthy != 1 || len(h.Stores) != 1 {
+		t.Errorf("expected pebble index to be ready with one healthy store, got %d %+v", code, h)
+	}
+	pi.Close()
+	if code, _ := get(pi); code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 once the index is closed, got %d", code)
+	}
+}
+
+func TestNewRouter_Status(t *testing.T) {
+	get := func(promos index.PromoIndex) index.LoadStatus {
+		r := NewRouter(&product.Handler{}, &order.Handler{}, &coupon.Handler{}, promos)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/status", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 got %d", rr.Code)
+		}
+		var s index.LoadStatus
+		if err := json.Unmarshal(rr.Body.Bytes(), &s); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		return s
+	}
+
+	if s := get(index.NewMemoryIndexFromCodes("HAPPYHRS")); s.State != index.LoadReady || s.Percent != 100 {
+		t.Errorf("unexpected status for a loaded index: %+v", s)
+	}
+
+	path := filepath.Join(t.TempDir(), "codes.txt")
+	if err := os.WriteFile(path, []byte("HAPPYHRS\n"), 0o644); err != nil {
+		t.Fatalf("writing promo file: %v", err)
+	}
+	loader := index.Load(index.BackendMemory, []string{path}, index.Options{Quorum: 1})
+	defer loader.Close()
+	if _, err := loader.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait error: %v", err)
+	}
+	if s := get(loader); s.State != index.LoadReady || len(s.Sources) != 1 || s.Sources[0].Source != "codes.txt" {
+		t.Errorf("unexpected status for a loader: %+v", s)
+	}
+}
+
 func TestNewRouter_HeartbeatLive(t *testing.T) {
-	r := NewRouter()
+	r := NewRouter(&product.Handler{}, &order.Handler{}, &coupon.Handler{}, nil)
 
 	req := httptest.NewRequest(http.MethodGet, "/live", nil)
 	rr := httptest.NewRecorder()
@@ -71,7 +148,7 @@ func TestNewRouter_HeartbeatLive(t *testing.T) {
 }
 
 func TestNewRouter_CORSHeaders(t *testing.T) {
-	r := NewRouter()
+	r := NewRouter(&product.Handler{}, &order.Handler{}, &coupon.Handler{}, nil)
 
 	req := httptest.NewRequest(http.MethodOptions, "/stats", nil)
 	req.Header.Set("Origin", "http://example.com")
@@ -91,7 +168,7 @@ func TestNewRouter_CORSHeaders(t *testing.T) {
 }
 
 func TestNewRouter_APIProductRouteExists(t *testing.T) {
-	r := NewRouter()
+	r := NewRouter(&product.Handler{}, &order.Handler{}, &coupon.Handler{}, nil)
 
 	req := httptest.NewRequest(http.MethodOptions, "/api/product", nil)
 	req.Header.Set("Origin", "http://example.com")
@@ -110,7 +187,7 @@ func TestNewRouter_APIProductRouteExists(t *testing.T) {
 }
 
 func TestNewRouter_APIProductIdRouteExists(t *testing.T) {
-	r := NewRouter()
+	r := NewRouter(&product.Handler{}, &order.Handler{}, &coupon.Handler{}, nil)
 
 	req := httptest.NewRequest(http.MethodOptions, "/api/product/1", nil)
 	req.Header.Set("Origin", "http://example.com")
@@ -129,7 +206,7 @@ func TestNewRouter_APIProductIdRouteExists(t *testing.T) {
 }
 
 func TestNewRouter_APICreateOrderRouteExists(t *testing.T) {
-	r := NewRouter()
+	r := NewRouter(&product.Handler{}, &order.Handler{}, &coupon.Handler{}, nil)
 
 	req := httptest.NewRequest(http.MethodOptions, "/api/order", nil)
 	req.Header.Set("Origin", "http://example.com")
@@ -146,3 +223,74 @@ func TestNewRouter_APICreateOrderRouteExists(t *testing.T) {
 		t.Fatalf("expected Access-Control-Allow-Origin header in OPTIONS /api/order response")
 	}
 }
+
+func TestNewRouter_APIFindOrderRouteExists(t *testing.T) {
+	r := NewRouter(&product.Handler{}, &order.Handler{}, &coupon.Handler{}, nil)
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/order/7f1b6a9e-6f6e-4c39-9a57-3f0b8d1f2c11", nil)
+	req.Header.Set("Origin", "http://example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent && rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 or 204 for OPTIONS /api/order/{orderId}, got %d", rr.Code)
+	}
+
+	if rr.Header().Get("Access-Control-Allow-Origin") == "" {
+		t.Fatalf("expected Access-Control-Allow-Origin header in OPTIONS /api/order/{orderId} response")
+	}
+}
+
+func TestNewRouter_DoesNotServeDebugVars(t *testing.T) {
+	r := NewRouter(&product.Handler{}, &order.Handler{}, &coupon.Handler{}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 on the public router got %d", rr.Code)
+	}
+}
+
+func TestNewDebugRouter_DebugVarsIncludesPromoCounters(t *testing.T) {
+	r := NewDebugRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d", rr.Code)
+	}
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(rr.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	for _, name := range []string{"promo_bloom", "promo_failures", "promo_lookups"} {
+		if _, ok := vars[name]; !ok {
+			t.Errorf("expected %s in /debug/vars", name)
+		}
+	}
+}
+
+func TestNewRouter_APIPromoValidateRouteExists(t *testing.T) {
+	r := NewRouter(&product.Handler{}, &order.Handler{}, &coupon.Handler{}, nil)
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/promo/validate", nil)
+	req.Header.Set("Origin", "http://example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent && rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 or 204 for OPTIONS /api/promo/validate, got %d", rr.Code)
+	}
+
+	if rr.Header().Get("Access-Control-Allow-Origin") == "" {
+		t.Fatalf("expected Access-Control-Allow-Origin header in OPTIONS /api/promo/validate response")
+	}
+}
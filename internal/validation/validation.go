@@ -10,7 +10,6 @@ import (
 	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
 	enTranslations "github.com/go-playground/validator/v10/translations/en"
-	"github.com/willf/bloom"
 )
 
 var (
@@ -18,56 +17,27 @@ var (
 	Translator ut.Translator
 )
 
-func isValidPromocodeLength(promocode string) bool {
-	if len(promocode) < 8 || len(promocode) > 10 {
-		return false
-	}
-	return true
-}
-
-func ValidatePromocodeBloom(bf *bloom.BloomFilter) func(fl validator.FieldLevel) bool {
-	return func(fl validator.FieldLevel) bool {
-		field := fl.Field()
-		if field.Kind() != reflect.String {
-			return false
-		}
-		code := field.String()
-		if !isValidPromocodeLength(code) {
-			return false
-		}
-
-		return bf.TestString(code)
-	}
-
-}
-
-func ValidatePromocodePebble(idx *index.PebbleIndex) func(fl validator.FieldLevel) bool {
+// ValidatePromocode checks that the code is well formed under policy, so
+// codes of the wrong length or alphabet fail before any store is queried.
+// Whether the code is known is left to the order handler, which looks it
+// up once and reports the answer or a failed lookup itself.
+func ValidatePromocode(policy index.Policy) func(fl validator.FieldLevel) bool {
 	return func(fl validator.FieldLevel) bool {
 		field := fl.Field()
 		if field.Kind() != reflect.String {
 			return false
 		}
-		code := field.String()
-		if !isValidPromocodeLength(code) {
-			return false
-		}
-
-		validated, err := idx.IsValid2of3(code)
-		if err != nil {
-			log.Panicf("Error validating promocode")
-		}
-
-		return validated
+		_, ok := policy.Canonical(field.String())
+		return ok
 	}
 
 }
 
-func RegisterPromocodeValidation(index *index.PebbleIndex) error {
-	log.Println("Registering bloom filter validator")
-	if err := Validator.RegisterValidation("promocode", ValidatePromocodePebble(index)); err != nil {
+func RegisterPromocodeValidation(policy index.Policy) error {
+	log.Println("Registering promocode validator")
+	if err := Validator.RegisterValidation("promocode", ValidatePromocode(policy)); err != nil {
 		return err
 	}
-	log.Println("Initializing bloom filter completed")
 
 	return nil
 }
@@ -86,7 +56,7 @@ func RegisterTranslations() error {
 	return nil
 }
 
-func HTTPRequestValidatorInit(index *index.PebbleIndex) error {
+func HTTPRequestValidatorInit(policy index.Policy) error {
 
 	log.Println("Initializing request validator...")
 	Validator = validator.New()
@@ -95,7 +65,7 @@ func HTTPRequestValidatorInit(index *index.PebbleIndex) error {
 		return err
 	}
 
-	if err := RegisterPromocodeValidation(index); err != nil {
+	if err := RegisterPromocodeValidation(policy); err != nil {
 		return err
 	}
 
@@ -3,6 +3,7 @@ package validation
 import (
 	"testing"
 
+	"github.com/PerumallaGiridhar/oolio/internal/index"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -37,3 +38,43 @@ func TestRegisterTranslations_SetsGlobalTranslator(t *testing.T) {
 		t.Fatalf("expected non-empty translated message, got %q", msg)
 	}
 }
+
+func TestValidatePromocode_ChecksFormatOnly(t *testing.T) {
+	Validator = validator.New()
+	if err := RegisterPromocodeValidation(index.DefaultPolicy()); err != nil {
+		t.Fatalf("RegisterPromocodeValidation() error = %v", err)
+	}
+
+	type Req struct {
+		Code string `validate:"promocode"`
+	}
+	// Unknown codes are well formed; the order handler looks them up.
+	for code, wantValid := range map[string]bool{"HAPPYHRS": true, "unknown1": true, "SHORT": false, "TOOLONGCODE1": false} {
+		err := Validator.Struct(Req{Code: code})
+		if (err == nil) != wantValid {
+			t.Errorf("code %q: err = %v, want valid %v", code, err, wantValid)
+		}
+	}
+}
+
+func TestValidatePromocode_AppliesPolicy(t *testing.T) {
+	Validator = validator.New()
+	policy := index.Policy{Strip: "- ", Alphabet: "A-Z", MinLength: 8, MaxLength: 10}
+	if err := RegisterPromocodeValidation(policy); err != nil {
+		t.Fatalf("RegisterPromocodeValidation() error = %v", err)
+	}
+
+	type Req struct {
+		Code string `validate:"promocode"`
+	}
+	for code, wantValid := range map[string]bool{
+		" happy-hrs ": true,
+		"HAPPY HRS":   true,
+		"HAPPYHOURS1": false, // digits are outside the alphabet
+	} {
+		err := Validator.Struct(Req{Code: code})
+		if (err == nil) != wantValid {
+			t.Errorf("code %q: err = %v, want valid %v", code, err, wantValid)
+		}
+	}
+}